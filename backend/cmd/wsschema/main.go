@@ -0,0 +1,31 @@
+// Command wsschema writes the JSON Schema of the WebSocket protocol. Run it
+// with go generate ./pkg/websocket after changing pkg/websocket/protocol.go.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"social-nework/pkg/websocket"
+)
+
+func main() {
+	out := flag.String("o", "", "file to write the schema to (default stdout)")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(websocket.ProtocolSchema(), "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode schema: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		log.Fatalf("Failed to write schema: %v", err)
+	}
+}
@@ -21,17 +21,19 @@ func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		log.Printf("DEBUG: Session cookie found: %s", cookie.Value[:10]+"...")
 
 		// Validate session and get user ID
-		userID, err := GetUserIDFromSession(r)
+		record, err := getSessionRecord(r)
 		if err != nil {
 			log.Printf("DEBUG: Invalid session for path: %s, error: %v", r.URL.Path, err)
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
+		userID := record.UserID
 		log.Printf("DEBUG: Valid session for user: %s, path: %s", userID, r.URL.Path)
 
-		// Add user ID to request context
+		// Add user and session IDs to request context
 		ctx := context.WithValue(r.Context(), "user_id", userID)
+		ctx = context.WithValue(ctx, "session_id", record.ID)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
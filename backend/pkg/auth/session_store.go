@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"social-nework/pkg/models"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written for a session
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionModel struct {
+	DB *sql.DB
+}
+
+// Insert persists a new session row
+func (m *SessionModel) Insert(ctx context.Context, session models.Session) error {
+	stmt := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := m.DB.ExecContext(ctx, stmt,
+		session.ID,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt,
+	)
+	return err
+}
+
+// GetActive returns a session that is neither revoked nor expired
+func (m *SessionModel) GetActive(ctx context.Context, sessionID string) (*models.Session, error) {
+	stmt := `
+		SELECT id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+		       created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE id = ? AND revoked_at IS NULL AND expires_at > ?
+	`
+	var session models.Session
+	err := m.DB.QueryRowContext(ctx, stmt, sessionID, time.Now().Unix()).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Touch records activity on a session, skipping the write if it was seen recently
+func (m *SessionModel) Touch(ctx context.Context, session *models.Session) error {
+	now := time.Now()
+	if now.Sub(time.Unix(session.LastSeenAt, 0)) < sessionTouchInterval {
+		return nil
+	}
+	_, err := m.DB.ExecContext(ctx, `UPDATE sessions SET last_seen_at = ? WHERE id = ?`, now.Unix(), session.ID)
+	if err == nil {
+		session.LastSeenAt = now.Unix()
+	}
+	return err
+}
+
+// ListActive returns all active sessions for a user, most recently used first
+func (m *SessionModel) ListActive(ctx context.Context, userID string) ([]models.Session, error) {
+	stmt := `
+		SELECT id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''),
+		       created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ?
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, time.Now().Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if sessions == nil {
+		sessions = []models.Session{}
+	}
+	return sessions, nil
+}
+
+// Revoke revokes a single session belonging to the user
+func (m *SessionModel) Revoke(ctx context.Context, sessionID, userID string) error {
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = ?
+		WHERE id = ? AND user_id = ? AND revoked_at IS NULL`,
+		time.Now().Unix(), sessionID, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll revokes every active session of the user except exceptID (pass "" to revoke all)
+func (m *SessionModel) RevokeAll(ctx context.Context, userID, exceptID string) (int64, error) {
+	result, err := m.DB.ExecContext(ctx, `
+		UPDATE sessions SET revoked_at = ?
+		WHERE user_id = ? AND id != ? AND revoked_at IS NULL`,
+		time.Now().Unix(), userID, exceptID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExpired removes sessions that expired or were revoked before the cutoff
+func (m *SessionModel) DeleteExpired(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := m.DB.ExecContext(ctx, `
+		DELETE FROM sessions
+		WHERE expires_at < ? OR (revoked_at IS NOT NULL AND revoked_at < ?)`,
+		cutoff.Unix(), cutoff.Unix())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -2,16 +2,35 @@
 package auth
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
+
+	"social-nework/pkg/models"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/sessions"
 )
 
-// Session store with a secure key
-var store = sessions.NewCookieStore([]byte("12345678901234567890123456789012")) // 32 bytes
+// Session store; the signing key and cookie policy are set by Configure
+var store *sessions.CookieStore
+
+// Server-side session records; the cookie only carries the session ID
+var sessionModel *SessionModel
+
+// Cookie policy shared by the session store and ClearSession
+var (
+	cookieSecure   = false
+	cookieSameSite = http.SameSiteStrictMode
+)
+
+// Reverse proxies allowed to report the client address in X-Forwarded-For
+var trustedProxies []*net.IPNet
 
 // Session name and duration
 const (
@@ -20,21 +39,45 @@ const (
 )
 
 func init() {
-	// Configure session store
+	// Development defaults until main calls Configure
+	Configure([]byte("12345678901234567890123456789012"), false, http.SameSiteStrictMode) // 32 bytes
+}
+
+// Configure sets the session signing key and cookie attributes
+func Configure(secret []byte, secure bool, sameSite http.SameSite) {
+	cookieSecure = secure
+	cookieSameSite = sameSite
+
+	store = sessions.NewCookieStore(secret)
 	store.Options = &sessions.Options{
 		Path:     "/",
 		MaxAge:   SessionMaxAge,
-		HttpOnly: false, // Allow JavaScript access for debugging
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode, // Change from Strict to Lax
+		HttpOnly: true, // Scripts use the CSRF token instead
+		Secure:   secure,
+		SameSite: sameSite,
 		Domain:   "", // Ensure no domain restriction
 	}
 }
 
+// SetTrustedProxies sets the proxies whose X-Forwarded-For header clientIP honours
+func SetTrustedProxies(nets []*net.IPNet) {
+	trustedProxies = nets
+}
+
+// InitSessions wires the sessions table used to validate and revoke sessions
+func InitSessions(db *sql.DB) *SessionModel {
+	sessionModel = &SessionModel{DB: db}
+	return sessionModel
+}
+
 // CreateSession creates a new session for a user
 func CreateSession(w http.ResponseWriter, r *http.Request, userID string) error {
 	log.Printf("DEBUG: CreateSession called with userID: %q (type: %T)", userID, userID)
-	
+
+	if sessionModel == nil {
+		return errors.New("session storage not initialized")
+	}
+
 	session, err := store.Get(r, SessionName)
 	if err != nil {
 		log.Printf("DEBUG: Failed to get existing session (creating new): %v", err)
@@ -42,25 +85,41 @@ func CreateSession(w http.ResponseWriter, r *http.Request, userID string) error
 		session = sessions.NewSession(store, SessionName)
 		session.IsNew = true
 	}
-	
-	log.Printf("DEBUG: Session retrieved/created successfully")
+
+	// A login always starts a fresh server-side session
+	now := time.Now()
+	record := models.Session{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		UserAgent:  r.UserAgent(),
+		IPAddress:  clientIP(r),
+		CreatedAt:  now.Unix(),
+		LastSeenAt: now.Unix(),
+		ExpiresAt:  now.Add(SessionMaxAge * time.Second).Unix(),
+	}
+	if err := sessionModel.Insert(r.Context(), record); err != nil {
+		log.Printf("ERROR: Failed to persist session: %v", err)
+		return err
+	}
 
 	// Set session values
-	log.Printf("DEBUG: Setting session values - userID: %q", userID)
 	session.Values["user_id"] = userID
 	session.Values["authenticated"] = true
-	session.Values["session_id"] = uuid.New().String()
-	
+	session.Values["session_id"] = record.ID
+	if err := setCSRFToken(w, session); err != nil {
+		log.Printf("ERROR: Failed to create CSRF token: %v", err)
+		return err
+	}
+
 	log.Printf("DEBUG: Session values set: %+v", session.Values)
 
 	// Save session
-	log.Printf("DEBUG: Attempting to save session")
 	err = session.Save(r, w)
 	if err != nil {
 		log.Printf("ERROR: Failed to save session: %v", err)
 		return err
 	}
-	
+
 	log.Printf("DEBUG: Session saved successfully")
 	return nil
 }
@@ -74,8 +133,8 @@ func ClearSession(w http.ResponseWriter, r *http.Request) error {
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteStrictMode,
+		Secure:   cookieSecure,
+		SameSite: cookieSameSite,
 	})
 
 	session, err := store.Get(r, SessionName)
@@ -85,9 +144,20 @@ func ClearSession(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	// Revoke the server-side record so the cookie can't be replayed
+	sessionID, _ := session.Values["session_id"].(string)
+	userID, _ := session.Values["user_id"].(string)
+	if sessionModel != nil && sessionID != "" {
+		if err := sessionModel.Revoke(r.Context(), sessionID, userID); err != nil && err != ErrSessionNotFound {
+			log.Printf("ERROR: Failed to revoke session %s: %v", sessionID, err)
+		}
+	}
+
 	// Clear session values
 	session.Values["user_id"] = nil
 	session.Values["authenticated"] = false
+	session.Values["session_id"] = nil
+	session.Values[csrfKey] = nil
 
 	// Set session to expire immediately
 	session.Options.MaxAge = -1
@@ -98,21 +168,93 @@ func ClearSession(w http.ResponseWriter, r *http.Request) error {
 
 // GetUserIDFromSession retrieves the user ID from the session
 func GetUserIDFromSession(r *http.Request) (string, error) {
-	session, err := store.Get(r, SessionName)
+	record, err := getSessionRecord(r)
 	if err != nil {
 		return "", err
 	}
+	return record.UserID, nil
+}
+
+// getSessionRecord decodes the cookie and checks it against the sessions table
+func getSessionRecord(r *http.Request) (*models.Session, error) {
+	session, err := store.Get(r, SessionName)
+	if err != nil {
+		return nil, err
+	}
 
 	// Check if authenticated
 	if auth, ok := session.Values["authenticated"].(bool); !ok || !auth {
-		return "", errors.New("not authenticated")
+		return nil, errors.New("not authenticated")
 	}
 
 	// Get user ID
 	userID, ok := session.Values["user_id"].(string)
 	if !ok {
-		return "", errors.New("invalid session")
+		return nil, errors.New("invalid session")
+	}
+
+	sessionID, ok := session.Values["session_id"].(string)
+	if !ok || sessionID == "" {
+		return nil, errors.New("invalid session")
+	}
+
+	if sessionModel == nil {
+		return nil, errors.New("session storage not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	record, err := sessionModel.GetActive(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if record.UserID != userID {
+		return nil, errors.New("invalid session")
 	}
 
-	return userID, nil
+	if err := sessionModel.Touch(ctx, record); err != nil {
+		log.Printf("ERROR: Failed to update session last seen: %v", err)
+	}
+
+	return record, nil
+}
+
+// clientIP returns the caller's address. X-Forwarded-For is only honoured when
+// the request comes from a trusted proxy, and then its hops are read from the
+// right so that a client cannot spoof its address by sending the header itself.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !isTrustedProxy(host) {
+		return host
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrustedProxy(hop) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
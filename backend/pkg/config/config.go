@@ -0,0 +1,451 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSessionSecret is only meant for local development
+const defaultSessionSecret = "12345678901234567890123456789012"
+
+// Config holds every setting needed to bootstrap the server
+type Config struct {
+	ListenAddr     string   `json:"listen_addr"`
+	DBPath         string   `json:"db_path"`
+	MigrationsDir  string   `json:"migrations_dir"`
+	UploadDir      string   `json:"upload_dir"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	CookieSecure   bool     `json:"cookie_secure"`
+	CookieSameSite string   `json:"cookie_samesite"` // "lax", "strict" or "none"
+	SessionSecret  string   `json:"session_secret"`
+	LogLevel       string   `json:"log_level"` // "debug", "info", "warn" or "error"
+
+	// Reverse proxies, as IPs or CIDR ranges, whose X-Forwarded-For header is
+	// trusted for client addresses; the header is ignored from anyone else
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// Deleted posts can be restored for this many days before they are purged
+	PostRetentionDays int `json:"post_retention_days"`
+
+	// Reactions users can leave on posts and comments; must include "like"
+	Reactions []string `json:"reactions"`
+
+	// How WebSocket events reach other backend processes: "local" when there is
+	// only one, "sqlite" for processes sharing db_path
+	Broker string `json:"broker"`
+
+	// What one WebSocket client may send; abusive connections are closed
+	WSMaxFrameBytes    int     `json:"ws_max_frame_bytes"`
+	WSMaxContentLength int     `json:"ws_max_content_length"` // Characters
+	WSFrameRate        float64 `json:"ws_frame_rate"`         // Frames per second per connection
+	WSFrameBurst       int     `json:"ws_frame_burst"`
+	WSMessageRate      float64 `json:"ws_message_rate"` // Chat messages per second per user
+	WSMessageBurst     int     `json:"ws_message_burst"`
+	WSMaxThrottled     int     `json:"ws_max_throttled"` // Throttled frames per minute before disconnecting
+
+	// Where uploaded files are kept: "local" for upload_dir, "s3" for a bucket
+	// of an S3-compatible store
+	Storage     string `json:"storage"`
+	S3Endpoint  string `json:"s3_endpoint"`
+	S3Region    string `json:"s3_region"`
+	S3Bucket    string `json:"s3_bucket"`
+	S3AccessKey string `json:"s3_access_key"`
+	S3SecretKey string `json:"s3_secret_key"`
+
+	// Uploaded files are only fetched through signed URLs valid this long
+	SignedURLMinutes int `json:"signed_url_minutes"`
+}
+
+// Default returns the configuration used for local development
+func Default() *Config {
+	return &Config{
+		ListenAddr:     ":3000",
+		DBPath:         "pkg/db/sqlite/social_network.db",
+		MigrationsDir:  "pkg/db/migrations/sqlite",
+		UploadDir:      "uploads",
+		AllowedOrigins: []string{"http://localhost:5173", "http://localhost:3000", "http://localhost:8080"},
+		CookieSecure:   false,
+		CookieSameSite: "strict",
+		SessionSecret:  defaultSessionSecret,
+		LogLevel:       "debug",
+
+		PostRetentionDays: 30,
+		Reactions:         []string{"like", "love", "laugh", "wow", "sad", "angry"},
+		Broker:            "local",
+
+		WSMaxFrameBytes:    64 << 10,
+		WSMaxContentLength: 4000,
+		WSFrameRate:        20,
+		WSFrameBurst:       40,
+		WSMessageRate:      2,
+		WSMessageBurst:     10,
+		WSMaxThrottled:     50,
+
+		Storage:  "local",
+		S3Region: "us-east-1",
+
+		SignedURLMinutes: 15,
+	}
+}
+
+// Load builds the configuration from defaults, an optional JSON file and
+// environment overrides, then validates the result
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	if v := os.Getenv("LISTEN_ADDR"); v != "" {
+		c.ListenAddr = v
+	}
+	if v := os.Getenv("DB_PATH"); v != "" {
+		c.DBPath = v
+	}
+	if v := os.Getenv("MIGRATIONS_DIR"); v != "" {
+		c.MigrationsDir = v
+	}
+	if v := os.Getenv("UPLOAD_DIR"); v != "" {
+		c.UploadDir = v
+	}
+	if v := os.Getenv("ALLOWED_ORIGINS"); v != "" {
+		c.AllowedOrigins = splitList(v)
+	}
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		c.TrustedProxies = splitList(v)
+	}
+	if v := os.Getenv("COOKIE_SECURE"); v != "" {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid COOKIE_SECURE %q: %w", v, err)
+		}
+		c.CookieSecure = secure
+	}
+	if v := os.Getenv("COOKIE_SAMESITE"); v != "" {
+		c.CookieSameSite = v
+	}
+	if v := os.Getenv("SESSION_SECRET"); v != "" {
+		c.SessionSecret = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		c.LogLevel = v
+	}
+	if v := os.Getenv("REACTIONS"); v != "" {
+		c.Reactions = splitList(v)
+	}
+	if v := os.Getenv("BROKER"); v != "" {
+		c.Broker = v
+	}
+	if v := os.Getenv("STORAGE"); v != "" {
+		c.Storage = v
+	}
+	if v := os.Getenv("S3_ENDPOINT"); v != "" {
+		c.S3Endpoint = v
+	}
+	if v := os.Getenv("S3_REGION"); v != "" {
+		c.S3Region = v
+	}
+	if v := os.Getenv("S3_BUCKET"); v != "" {
+		c.S3Bucket = v
+	}
+	if v := os.Getenv("S3_ACCESS_KEY"); v != "" {
+		c.S3AccessKey = v
+	}
+	if v := os.Getenv("S3_SECRET_KEY"); v != "" {
+		c.S3SecretKey = v
+	}
+	if v := os.Getenv("SIGNED_URL_MINUTES"); v != "" {
+		minutes, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid SIGNED_URL_MINUTES %q: %w", v, err)
+		}
+		c.SignedURLMinutes = minutes
+	}
+	if v := os.Getenv("POST_RETENTION_DAYS"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid POST_RETENTION_DAYS %q: %w", v, err)
+		}
+		c.PostRetentionDays = days
+	}
+
+	for name, dst := range map[string]*int{
+		"WS_MAX_FRAME_BYTES":    &c.WSMaxFrameBytes,
+		"WS_MAX_CONTENT_LENGTH": &c.WSMaxContentLength,
+		"WS_FRAME_BURST":        &c.WSFrameBurst,
+		"WS_MESSAGE_BURST":      &c.WSMessageBurst,
+		"WS_MAX_THROTTLED":      &c.WSMaxThrottled,
+	} {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = n
+		}
+	}
+	for name, dst := range map[string]*float64{
+		"WS_FRAME_RATE":   &c.WSFrameRate,
+		"WS_MESSAGE_RATE": &c.WSMessageRate,
+	} {
+		if v := os.Getenv(name); v != "" {
+			rate, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", name, v, err)
+			}
+			*dst = rate
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration and normalises values in place
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.ListenAddr == "" {
+		errs = append(errs, errors.New("listen_addr is required"))
+	}
+	if c.DBPath == "" {
+		errs = append(errs, errors.New("db_path is required"))
+	}
+	if c.MigrationsDir == "" {
+		errs = append(errs, errors.New("migrations_dir is required"))
+	} else if info, err := os.Stat(c.MigrationsDir); err != nil || !info.IsDir() {
+		errs = append(errs, fmt.Errorf("migrations_dir %q is not a directory", c.MigrationsDir))
+	}
+	if c.UploadDir == "" {
+		errs = append(errs, errors.New("upload_dir is required"))
+	}
+
+	if len(c.AllowedOrigins) == 0 {
+		errs = append(errs, errors.New("allowed_origins must list at least one origin"))
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			errs = append(errs, fmt.Errorf("allowed origin %q must start with http:// or https://", origin))
+		}
+	}
+
+	for _, proxy := range c.TrustedProxies {
+		if parseProxy(proxy) == nil {
+			errs = append(errs, fmt.Errorf("trusted proxy %q must be an IP address or CIDR range", proxy))
+		}
+	}
+
+	c.CookieSameSite = strings.ToLower(c.CookieSameSite)
+	switch c.CookieSameSite {
+	case "lax", "strict":
+	case "none":
+		if !c.CookieSecure {
+			errs = append(errs, errors.New("cookie_samesite \"none\" requires cookie_secure"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid cookie_samesite %q", c.CookieSameSite))
+	}
+
+	if len(c.SessionSecret) < 32 {
+		errs = append(errs, errors.New("session_secret must be at least 32 bytes"))
+	} else if c.SessionSecret == defaultSessionSecret {
+		log.Printf("WARNING: using the development session secret, set SESSION_SECRET outside local development")
+	}
+
+	c.LogLevel = strings.ToLower(c.LogLevel)
+	if _, ok := logLevels[c.LogLevel]; !ok {
+		errs = append(errs, fmt.Errorf("invalid log_level %q", c.LogLevel))
+	}
+
+	if c.PostRetentionDays <= 0 {
+		errs = append(errs, errors.New("post_retention_days must be positive"))
+	}
+
+	hasLike := false
+	seen := make(map[string]bool)
+	for i, reaction := range c.Reactions {
+		reaction = strings.ToLower(strings.TrimSpace(reaction))
+		c.Reactions[i] = reaction
+		if reaction == "" || len(reaction) > 32 || strings.Trim(reaction, "abcdefghijklmnopqrstuvwxyz_") != "" {
+			errs = append(errs, fmt.Errorf("invalid reaction %q", reaction))
+		}
+		if seen[reaction] {
+			errs = append(errs, fmt.Errorf("duplicate reaction %q", reaction))
+		}
+		seen[reaction] = true
+		hasLike = hasLike || reaction == "like"
+	}
+	if !hasLike {
+		errs = append(errs, errors.New("reactions must include \"like\""))
+	}
+
+	if c.WSMaxFrameBytes < 1024 {
+		errs = append(errs, errors.New("ws_max_frame_bytes must be at least 1024"))
+	}
+	if c.WSMaxContentLength <= 0 {
+		errs = append(errs, errors.New("ws_max_content_length must be positive"))
+	}
+	if c.WSFrameRate <= 0 || c.WSMessageRate <= 0 {
+		errs = append(errs, errors.New("ws_frame_rate and ws_message_rate must be positive"))
+	}
+	if c.WSFrameBurst < 1 || c.WSMessageBurst < 1 {
+		errs = append(errs, errors.New("ws_frame_burst and ws_message_burst must be at least 1"))
+	}
+	if c.WSMaxThrottled < 1 {
+		errs = append(errs, errors.New("ws_max_throttled must be at least 1"))
+	}
+
+	c.Broker = strings.ToLower(c.Broker)
+	if c.Broker != "local" && c.Broker != "sqlite" {
+		errs = append(errs, fmt.Errorf("invalid broker %q", c.Broker))
+	}
+
+	c.Storage = strings.ToLower(c.Storage)
+	switch c.Storage {
+	case "local":
+	case "s3":
+		if !strings.HasPrefix(c.S3Endpoint, "http://") && !strings.HasPrefix(c.S3Endpoint, "https://") {
+			errs = append(errs, errors.New("s3_endpoint must start with http:// or https://"))
+		}
+		if c.S3Region == "" || c.S3Bucket == "" || c.S3AccessKey == "" || c.S3SecretKey == "" {
+			errs = append(errs, errors.New("s3 storage needs s3_region, s3_bucket, s3_access_key and s3_secret_key"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid storage %q", c.Storage))
+	}
+	if c.SignedURLMinutes < 1 || c.SignedURLMinutes > 7*24*60 {
+		errs = append(errs, errors.New("signed_url_minutes must be between 1 and 10080 (7 days)"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// PrepareDirs creates the directories the server writes into and makes the
+// upload directory absolute
+func (c *Config) PrepareDirs() error {
+	if dir := filepath.Dir(c.DBPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+	if c.Storage != "local" {
+		return nil
+	}
+
+	// Uploads must not move with the working directory
+	uploadDir, err := filepath.Abs(c.UploadDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve upload directory: %w", err)
+	}
+	c.UploadDir = uploadDir
+	if err := os.MkdirAll(c.UploadDir, 0755); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	return nil
+}
+
+// PostRetention is how long soft-deleted posts are kept before being purged
+func (c *Config) PostRetention() time.Duration {
+	return time.Duration(c.PostRetentionDays) * 24 * time.Hour
+}
+
+// SignedURLTTL is how long signed URLs of uploaded files stay valid
+func (c *Config) SignedURLTTL() time.Duration {
+	return time.Duration(c.SignedURLMinutes) * time.Minute
+}
+
+// TrustedProxyNets returns the trusted proxies as networks, a single address
+// becoming a network of one
+func (c *Config) TrustedProxyNets() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, proxy := range c.TrustedProxies {
+		if n := parseProxy(proxy); n != nil {
+			nets = append(nets, n)
+		}
+	}
+	return nets
+}
+
+// SameSite maps the configured cookie policy to its http constant
+func (c *Config) SameSite() http.SameSite {
+	switch c.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// URLSigningKey is the key signing URLs of locally stored files, derived from
+// the session secret so that rotating one rotates the other
+func (c *Config) URLSigningKey() []byte {
+	mac := hmac.New(sha256.New, []byte(c.SessionSecret))
+	mac.Write([]byte("storage url signing"))
+	return mac.Sum(nil)
+}
+
+// parseProxy parses an IP address or CIDR range, returning nil if it is neither
+func parseProxy(v string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(v); err == nil {
+		return n
+	}
+	ip := net.ParseIP(v)
+	if ip == nil {
+		return nil
+	}
+	bits := 8 * net.IPv6len
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, bits = ip4, 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+)
+
+var logLevels = map[string]int{
+	"debug": 0,
+	"info":  1,
+	"warn":  2,
+	"error": 3,
+}
+
+// levelWriter drops log lines whose tag is below the configured level.
+// Lines are tagged by convention, e.g. log.Printf("DEBUG: ...")
+type levelWriter struct {
+	out      io.Writer
+	minLevel int
+}
+
+var lineTags = []struct {
+	tag   []byte
+	level int
+}{
+	{[]byte("DEBUG:"), 0},
+	{[]byte("WARNING:"), 2},
+	{[]byte("ERROR:"), 3},
+}
+
+func (w levelWriter) Write(p []byte) (int, error) {
+	level := 1 // untagged lines are informational
+	for _, t := range lineTags {
+		if bytes.Contains(p, t.tag) {
+			level = t.level
+			break
+		}
+	}
+	if level < w.minLevel {
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// ApplyLogging installs the configured log level on the standard logger
+func (c *Config) ApplyLogging() {
+	log.SetOutput(levelWriter{out: os.Stderr, minLevel: logLevels[c.LogLevel]})
+}
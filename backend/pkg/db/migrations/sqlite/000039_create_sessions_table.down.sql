@@ -0,0 +1 @@
+DROP TABLE sessions;
\ No newline at end of file
@@ -0,0 +1,14 @@
+CREATE TABLE post_revisions (
+    id TEXT PRIMARY KEY,
+    post_id TEXT NOT NULL,
+    editor_id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    image_url TEXT,
+    privacy TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_post_revisions_post_id ON post_revisions(post_id, created_at);
+
+ALTER TABLE posts ADD COLUMN edited_at INTEGER;
@@ -0,0 +1,25 @@
+CREATE TABLE notifications_new (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    type TEXT NOT NULL CHECK(type IN ('follow_request', 'new_follower', 'new_comment', 'group_invite', 'event_created', 'new_like', 'group_join_request', 'group_join_response', 'group_invitation_response', 'new_message')),
+    reference_id TEXT NOT NULL,
+    is_read INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL,
+    deleted_at INTEGER,
+    actor_id TEXT,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO notifications_new (id, user_id, type, reference_id, is_read, created_at, deleted_at, actor_id)
+SELECT id, user_id, type, reference_id, is_read, created_at, deleted_at, actor_id FROM notifications
+WHERE type != 'comment_reply';
+
+DROP TABLE notifications;
+ALTER TABLE notifications_new RENAME TO notifications;
+
+CREATE INDEX idx_notifications_user_id ON notifications(user_id);
+CREATE INDEX idx_notifications_reference_id ON notifications(reference_id);
+CREATE INDEX idx_notifications_actor_id ON notifications(actor_id);
+
+DROP INDEX IF EXISTS idx_comments_parent_comment_id;
+ALTER TABLE comments DROP COLUMN parent_comment_id;
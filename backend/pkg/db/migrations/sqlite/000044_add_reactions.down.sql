@@ -0,0 +1,3 @@
+ALTER TABLE notifications DROP COLUMN reaction;
+DROP INDEX IF EXISTS idx_likes_content_reaction;
+ALTER TABLE likes DROP COLUMN reaction;
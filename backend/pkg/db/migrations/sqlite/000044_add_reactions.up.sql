@@ -0,0 +1,6 @@
+-- Every existing like becomes a 'like' reaction; users keep one reaction per item
+ALTER TABLE likes ADD COLUMN reaction TEXT NOT NULL DEFAULT 'like';
+CREATE INDEX idx_likes_content_reaction ON likes(likeable_type, likeable_id, reaction);
+
+-- Remember which reaction triggered a new_like notification
+ALTER TABLE notifications ADD COLUMN reaction TEXT;
@@ -0,0 +1,2 @@
+-- When the user was last connected (or went away); NULL if never seen
+ALTER TABLE users ADD COLUMN last_seen_at INTEGER;
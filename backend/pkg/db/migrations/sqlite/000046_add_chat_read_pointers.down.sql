@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_messages_chat_sent_at;
+ALTER TABLE chat_participants DROP COLUMN last_read_at;
+ALTER TABLE chat_participants DROP COLUMN last_read_message_id;
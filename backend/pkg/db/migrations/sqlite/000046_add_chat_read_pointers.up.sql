@@ -0,0 +1,18 @@
+-- Each participant's last read message; everything up to it counts as read
+ALTER TABLE chat_participants ADD COLUMN last_read_message_id TEXT;
+ALTER TABLE chat_participants ADD COLUMN last_read_at INTEGER;
+
+-- Carry over the old single read_at: the newest message someone else sent
+-- that was marked read becomes the participant's pointer
+UPDATE chat_participants SET last_read_message_id = (
+    SELECT m.id FROM messages m
+    WHERE m.chat_id = chat_participants.chat_id
+    AND m.sender_id != chat_participants.user_id
+    AND m.read_at IS NOT NULL
+    ORDER BY m.sent_at DESC, m.rowid DESC LIMIT 1
+);
+-- read_at was not always stored as a Unix timestamp, so start from now
+UPDATE chat_participants SET last_read_at = CAST(strftime('%s', 'now') AS INTEGER)
+WHERE last_read_message_id IS NOT NULL;
+
+CREATE INDEX idx_messages_chat_sent_at ON messages(chat_id, sent_at);
@@ -0,0 +1,22 @@
+ALTER TABLE messages ADD COLUMN edited_at INTEGER;
+
+-- Previous contents of edited messages
+CREATE TABLE message_revisions (
+    id TEXT PRIMARY KEY,
+    message_id TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at INTEGER NOT NULL, -- When this content was replaced
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_message_revisions_message_id ON message_revisions(message_id, created_at);
+
+-- One emoji reaction per user per message
+CREATE TABLE message_reactions (
+    message_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    reaction TEXT NOT NULL,
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
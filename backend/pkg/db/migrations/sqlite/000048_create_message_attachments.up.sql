@@ -0,0 +1,20 @@
+-- Files uploaded to a chat; message_id is set once they are sent with a message
+CREATE TABLE message_attachments (
+    id TEXT PRIMARY KEY,
+    chat_id TEXT NOT NULL,
+    message_id TEXT,
+    uploader_id TEXT NOT NULL,
+    storage_path TEXT NOT NULL, -- Relative to the upload directory
+    filename TEXT NOT NULL, -- Original name, used for downloads
+    mime_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    width INTEGER, -- Images only
+    height INTEGER,
+    position INTEGER NOT NULL DEFAULT 0, -- Order within the message
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (chat_id) REFERENCES chats(id) ON DELETE CASCADE,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_message_attachments_message_id ON message_attachments(message_id, position);
+CREATE INDEX idx_message_attachments_chat_id ON message_attachments(chat_id);
@@ -0,0 +1,8 @@
+-- Events handed between backend processes by the SQLite WebSocket broker; pruned after a minute
+CREATE TABLE hub_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    origin TEXT NOT NULL, -- Process that published the event
+    body TEXT NOT NULL, -- JSON encoded websocket.BrokerEvent
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX idx_hub_events_created_at ON hub_events(created_at);
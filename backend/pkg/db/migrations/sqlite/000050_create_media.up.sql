@@ -0,0 +1,18 @@
+-- Files uploaded through /api/upload. Each is stored in the upload directory
+-- under its filename, with medium and thumbnail variants for large images.
+CREATE TABLE media (
+    id TEXT PRIMARY KEY,
+    owner_id TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('image', 'video')),
+    mime_type TEXT NOT NULL, -- Sniffed from the content, never the client's claim
+    size INTEGER NOT NULL, -- Of the stored original
+    width INTEGER, -- Images only
+    height INTEGER,
+    sha256 TEXT NOT NULL,
+    filename TEXT NOT NULL UNIQUE, -- Served as /uploads/<filename>
+    medium_filename TEXT UNIQUE, -- NULL when the original is small enough
+    thumbnail_filename TEXT UNIQUE,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (owner_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_media_owner_id ON media(owner_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS post_revision_media;
+DROP TABLE IF EXISTS post_media;
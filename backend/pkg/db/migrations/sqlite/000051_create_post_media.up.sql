@@ -0,0 +1,23 @@
+-- Ordered galleries of media attached to posts, and to their previous
+-- versions so revisions keep the gallery they were shown with.
+CREATE TABLE post_media (
+    post_id TEXT NOT NULL,
+    media_id TEXT NOT NULL,
+    position INTEGER NOT NULL, -- 0-based order in the gallery
+    alt_text TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (post_id, position),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_post_media_media_id ON post_media(media_id);
+
+CREATE TABLE post_revision_media (
+    revision_id TEXT NOT NULL,
+    media_id TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    alt_text TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (revision_id, position),
+    FOREIGN KEY (revision_id) REFERENCES post_revisions(id) ON DELETE CASCADE,
+    FOREIGN KEY (media_id) REFERENCES media(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_post_revision_media_media_id ON post_revision_media(media_id);
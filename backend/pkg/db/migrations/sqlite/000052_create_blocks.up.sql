@@ -0,0 +1,13 @@
+-- Users a user has blocked or muted. A block works both ways: neither user
+-- can follow, chat with, comment on, react to, invite or see the other.
+-- A mute only hides the muted user's posts from the muter's feed.
+CREATE TABLE blocks (
+    blocker_id TEXT NOT NULL,
+    blocked_id TEXT NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+    created_at INTEGER NOT NULL,
+    PRIMARY KEY (blocker_id, blocked_id, kind),
+    FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_blocks_blocked_id ON blocks(blocked_id, kind);
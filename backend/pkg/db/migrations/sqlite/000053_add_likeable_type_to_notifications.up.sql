@@ -0,0 +1,3 @@
+-- Remember whether a new_like notification is about a post or a comment;
+-- older rows stay NULL and are read as posts
+ALTER TABLE notifications ADD COLUMN likeable_type TEXT;
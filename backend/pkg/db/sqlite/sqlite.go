@@ -2,7 +2,9 @@ package sqlite
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/sqlite3"
@@ -10,30 +12,38 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-func NewDB(dataSourceName string) (*sql.DB, error) {
-	dbPath := "pkg/db/sqlite/" + dataSourceName
+// NewDB opens the SQLite database at dbPath and applies the migrations found in migrationsDir
+func NewDB(dbPath, migrationsDir string) (*sql.DB, error) {
 	log.Println("DB path:", dbPath)
 
-	db, err := sql.Open("sqlite3", dbPath)
+	// Wait for locks rather than failing, as other backend processes may share the file
+	dsn := dbPath + "?_busy_timeout=5000"
+	if strings.Contains(dbPath, "?") {
+		dsn = dbPath + "&_busy_timeout=5000"
+	}
+	db, err := sql.Open("sqlite3", dsn)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	driver, err := sqlite3.WithInstance(db, &sqlite3.Config{})
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, fmt.Errorf("failed to create migration driver: %w", err)
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(
-		"file://pkg/db/migrations/sqlite",
+		"file://"+migrationsDir,
 		"sqlite3", driver,
 	)
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
 	}
 
-	if err := m.Up(); err != nil && err.Error() != "no change" {
-		log.Fatalf("Migration failed: %v", err)
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		db.Close()
+		return nil, fmt.Errorf("migration failed: %w", err)
 	}
 
 	log.Println("Migration applied successfully")
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"social-nework/pkg/models"
+
+	"github.com/gorilla/mux"
+)
+
+// blockMessages confirm each kind of block being added and removed
+var blockMessages = map[string][2]string{
+	models.BlockKindBlock: {"User blocked", "User unblocked"},
+	models.BlockKindMute:  {"User muted", "User unmuted"},
+}
+
+// AddBlock blocks or mutes the user in the URL ("block" or "mute" as kind)
+func AddBlock(db *sql.DB, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID := mux.Vars(r)["userID"]
+		if targetID == "" {
+			http.Error(w, "User ID required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := models.AddBlock(db, ctx, userID, targetID, kind); err != nil {
+			switch err {
+			case models.ErrCannotBlockSelf:
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case models.ErrUserNotFound:
+				http.Error(w, "User not found", http.StatusNotFound)
+			default:
+				log.Printf("ERROR: Failed to %s user %s: %v", kind, targetID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": blockMessages[kind][0]})
+	}
+}
+
+// RemoveBlock unblocks or unmutes the user in the URL
+func RemoveBlock(db *sql.DB, kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		targetID := mux.Vars(r)["userID"]
+		if targetID == "" {
+			http.Error(w, "User ID required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := models.RemoveBlock(db, ctx, userID, targetID, kind); err != nil {
+			log.Printf("ERROR: Failed to un%s user %s: %v", kind, targetID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": blockMessages[kind][1]})
+	}
+}
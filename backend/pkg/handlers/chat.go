@@ -2,6 +2,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"social-nework/pkg/auth"
 	"social-nework/pkg/models"
 	"social-nework/pkg/repository"
+	"social-nework/pkg/storage"
 	"social-nework/pkg/websocket"
 
 	"github.com/google/uuid"
@@ -23,15 +25,19 @@ type ChatHandler struct {
 	groupRepo        *repository.GroupRepository
 	notificationRepo *models.NotificationModel
 	hub              *websocket.Hub
+	store            storage.Backend
+	urlTTL           time.Duration // Validity of signed attachment URLs
 }
 
-func NewChatHandler(chatRepo *repository.ChatRepository, messageRepo *repository.MessageRepository, groupRepo *repository.GroupRepository, hub *websocket.Hub, notificationRepo *models.NotificationModel) *ChatHandler {
+func NewChatHandler(chatRepo *repository.ChatRepository, messageRepo *repository.MessageRepository, groupRepo *repository.GroupRepository, hub *websocket.Hub, notificationRepo *models.NotificationModel, store storage.Backend, urlTTL time.Duration) *ChatHandler {
 	return &ChatHandler{
 		chatRepo:         chatRepo,
 		messageRepo:      messageRepo,
 		groupRepo:        groupRepo,
 		notificationRepo: notificationRepo,
 		hub:              hub,
+		store:            store,
+		urlTTL:           urlTTL,
 	}
 }
 
@@ -50,8 +56,9 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Content string `json:"content"`
-		Type    string `json:"type,omitempty"` // text, image, file, etc.
+		Content       string   `json:"content"`
+		Type          string   `json:"type,omitempty"`           // text, image, file, etc.
+		AttachmentIDs []string `json:"attachment_ids,omitempty"` // From UploadAttachment
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -62,7 +69,7 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("SendMessage: content=%s, type=%s", req.Content, req.Type)
 
-	if req.Content == "" {
+	if req.Content == "" && len(req.AttachmentIDs) == 0 {
 		log.Printf("SendMessage: Message content is required")
 		http.Error(w, "Message content is required", http.StatusBadRequest)
 		return
@@ -135,12 +142,26 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 	log.Printf("SendMessage: Created message with ID=%s", message.ID)
 
 	// Save message to database
-	if err := h.messageRepo.SaveMessage(message); err != nil {
+	if err := h.messageRepo.SaveMessageWithAttachments(message, req.AttachmentIDs); err != nil {
+		if err == repository.ErrInvalidAttachment {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		log.Printf("SendMessage: Error saving message: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	attachments := []models.Attachment{}
+	if len(req.AttachmentIDs) > 0 {
+		saved, err := h.messageRepo.GetMessageByID(message.ID)
+		if err != nil {
+			log.Printf("SendMessage: Error loading attachments: %v", err)
+		} else {
+			attachments = saved.Attachments
+		}
+	}
+
 	// Get sender info first for notifications
 	var sender models.User
 	err = h.chatRepo.DB.QueryRow(`
@@ -206,8 +227,9 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 			"id":        message.ID,
 			"chat_id":   message.ChatID,
 			"sender_id": message.SenderID,
-			"content":   message.Content,
-			"sent_at":   message.SentAt,
+			"content":     message.Content,
+			"sent_at":     message.SentAt,
+			"attachments": attachments,
 			"sender": map[string]interface{}{
 				"first_name": sender.FirstName,
 				"last_name":  sender.LastName,
@@ -226,8 +248,9 @@ func (h *ChatHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
 			"id":        message.ID,
 			"chat_id":   message.ChatID,
 			"sender_id": message.SenderID,
-			"content":   message.Content,
-			"sent_at":   message.SentAt,
+			"content":     message.Content,
+			"sent_at":     message.SentAt,
+			"attachments": attachments,
 			"sender": map[string]interface{}{
 				"first_name": sender.FirstName,
 				"last_name":  sender.LastName,
@@ -430,6 +453,12 @@ func (h *ChatHandler) GetUserChats(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			unread, err := h.messageRepo.GetUnreadMessageCount(chat.ID, userID)
+			if err != nil {
+				log.Printf("GetUserChats: Error counting unread messages: %v", err)
+			}
+			enhancedChat["unread_count"] = unread
+
 			enhancedChats = append(enhancedChats, enhancedChat)
 		}
 	}
@@ -502,6 +531,12 @@ func (h *ChatHandler) GetUserChats(w http.ResponseWriter, r *http.Request) {
 				}
 			}
 
+			unread, err := h.messageRepo.GetUnreadMessageCount(chatID, userID)
+			if err != nil {
+				log.Printf("GetUserChats: Error counting unread messages: %v", err)
+			}
+			groupChat["unread_count"] = unread
+
 			enhancedChats = append(enhancedChats, groupChat)
 		}
 	}
@@ -547,10 +582,10 @@ func (h *ChatHandler) AddParticipant(w http.ResponseWriter, r *http.Request) {
 	notification := websocket.MessagePayload{
 		Type:   "participant_added",
 		ChatID: chatID,
-		Data: map[string]interface{}{
-			"user_id":   req.UserID,
-			"added_by":  userID,
-			"timestamp": time.Now(),
+		Data: websocket.MemberData{
+			UserID:    req.UserID,
+			AddedBy:   userID,
+			Timestamp: time.Now(),
 		},
 	}
 	h.hub.BroadcastToChatRoom(chatID, notification, "")
@@ -616,10 +651,115 @@ func (h *ChatHandler) GetChatMessages(w http.ResponseWriter, r *http.Request) {
 		messages[i], messages[j] = messages[j], messages[i]
 	}
 
+	receipts, err := h.messageRepo.GetReadReceipts(chatID)
+	if err != nil {
+		log.Printf("Error getting read receipts: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages":      messages,
+		"has_more":      len(messages) == limit,
+		"read_receipts": receipts,
+	})
+}
+
+// MarkChatRead moves the user's read pointer up to a message (or the latest one)
+// and sends a read_receipt to the other participants
+func (h *ChatHandler) MarkChatRead(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	vars := mux.Vars(r)
+	chatID := vars["chatId"]
+
+	if chatID == "" {
+		http.Error(w, "Chat ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		MessageID string `json:"message_id,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	isInChat, err := h.chatRepo.IsUserInChat(chatID, userID)
+	if err != nil {
+		log.Printf("MarkChatRead: Error checking chat membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isInChat {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	receipt, advanced, err := h.messageRepo.MarkChatRead(chatID, userID, req.MessageID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("MarkChatRead: Error marking chat read: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if advanced {
+		h.hub.BroadcastReadReceipt(receipt)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"receipt": receipt,
+	})
+}
+
+// GetMessageRevisions returns the edit history of a message to chat participants
+func (h *ChatHandler) GetMessageRevisions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	vars := mux.Vars(r)
+	chatID, messageID := vars["chatId"], vars["messageId"]
+
+	isInChat, err := h.chatRepo.IsUserInChat(chatID, userID)
+	if err != nil {
+		log.Printf("GetMessageRevisions: Error checking chat membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isInChat {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	message, err := h.messageRepo.GetMessageByID(messageID)
+	if err == sql.ErrNoRows || (err == nil && message.ChatID != chatID) {
+		http.Error(w, "Message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("GetMessageRevisions: Error getting message: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	revisions, err := h.messageRepo.GetMessageRevisions(messageID)
+	if err != nil {
+		log.Printf("GetMessageRevisions: Error getting revisions: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
-		"messages": messages,
-		"has_more": len(messages) == limit,
+		"message":   message,
+		"revisions": revisions,
 	})
 }
 
@@ -701,6 +841,10 @@ func RegisterChatRoutes(router *mux.Router, handler *ChatHandler) {
 	chatRouter.HandleFunc("/{chatId}/messages", auth.RequireAuth(handler.GetChatMessages)).Methods("GET")
 	chatRouter.HandleFunc("/{chatId}/messages", auth.RequireAuth(handler.SendMessage)).Methods("POST")
 	chatRouter.HandleFunc("/{chatId}/participants", auth.RequireAuth(handler.AddParticipant)).Methods("POST")
+	chatRouter.HandleFunc("/{chatId}/read", auth.RequireAuth(handler.MarkChatRead)).Methods("POST")
+	chatRouter.HandleFunc("/{chatId}/attachments", auth.RequireAuth(handler.UploadAttachment)).Methods("POST")
+	chatRouter.HandleFunc("/{chatId}/attachments/{attachmentId}", auth.RequireAuth(handler.DownloadAttachment)).Methods("GET")
+	chatRouter.HandleFunc("/{chatId}/messages/{messageId}/revisions", auth.RequireAuth(handler.GetMessageRevisions)).Methods("GET")
 
 	// Group chat helper route
 	groupRouter := router.PathPrefix("/api/groups").Subrouter()
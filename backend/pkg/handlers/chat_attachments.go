@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"social-nework/pkg/models"
+	"social-nework/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// MaxAttachmentSize is the largest file that can be sent in a chat
+const MaxAttachmentSize = 25 << 20
+
+// attachmentDir is the storage key prefix of chat attachments; they are not
+// reachable through /uploads
+const attachmentDir = "attachments"
+
+// UploadAttachment stores a file for the user to send in a chat. The returned
+// attachment ID is passed in attachment_ids when sending the message.
+func (h *ChatHandler) UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	chatID := mux.Vars(r)["chatId"]
+
+	isInChat, err := h.chatRepo.IsUserInChat(chatID, userID)
+	if err != nil {
+		log.Printf("UploadAttachment: Error checking chat membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isInChat {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, MaxAttachmentSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "Unable to get file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	if header.Size > MaxAttachmentSize {
+		http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Trust the content over the client's claimed type
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	mimeType := http.DetectContentType(head[:n])
+	if mimeType == "application/octet-stream" {
+		if claimed, _, err := mime.ParseMediaType(header.Header.Get("Content-Type")); err == nil {
+			mimeType = claimed
+		}
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Unable to read file", http.StatusInternalServerError)
+		return
+	}
+
+	attachment := &models.Attachment{
+		ID:         uuid.New().String(),
+		ChatID:     chatID,
+		UploaderID: userID,
+		Filename:   attachmentFilename(header.Filename),
+		MimeType:   mimeType,
+		Size:       header.Size,
+		CreatedAt:  time.Now().Unix(),
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		if cfg, _, err := image.DecodeConfig(file); err == nil {
+			attachment.Width, attachment.Height = &cfg.Width, &cfg.Height
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Unable to read file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	attachment.StoragePath = path.Join(attachmentDir, attachment.ID+attachmentExt(attachment.Filename))
+	if err := h.store.Put(r.Context(), attachment.StoragePath, file, header.Size, mimeType); err != nil {
+		log.Printf("UploadAttachment: Unable to save file: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.messageRepo.CreateAttachment(attachment); err != nil {
+		h.store.Delete(r.Context(), attachment.StoragePath)
+		log.Printf("UploadAttachment: Error saving attachment: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"attachment": attachment,
+	})
+}
+
+// DownloadAttachment redirects the chat's participants to a signed URL of an attachment
+func (h *ChatHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("user_id").(string)
+	vars := mux.Vars(r)
+	chatID, attachmentID := vars["chatId"], vars["attachmentId"]
+
+	isInChat, err := h.chatRepo.IsUserInChat(chatID, userID)
+	if err != nil {
+		log.Printf("DownloadAttachment: Error checking chat membership: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !isInChat {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	attachment, err := h.messageRepo.GetAttachment(chatID, attachmentID, userID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("DownloadAttachment: Error getting attachment: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Only media is shown inline; anything else is downloaded so it cannot run in our origin
+	disposition := "attachment"
+	if isInlineMedia(attachment.MimeType) {
+		disposition = "inline"
+	}
+	redirectSigned(w, r, h.store, attachment.StoragePath, h.urlTTL, storage.URLOptions{
+		ContentType:        attachment.MimeType,
+		ContentDisposition: mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}),
+	})
+}
+
+func isInlineMedia(mimeType string) bool {
+	switch mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return true
+	}
+	return strings.HasPrefix(mimeType, "video/") || strings.HasPrefix(mimeType, "audio/")
+}
+
+// attachmentFilename keeps the base of the client's file name without control characters
+func attachmentFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	return name
+}
+
+// attachmentExt returns a short, safe extension for the stored file
+func attachmentExt(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if len(ext) > 10 {
+		return ""
+	}
+	for _, r := range strings.TrimPrefix(ext, ".") {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return ""
+		}
+	}
+	return ext
+}
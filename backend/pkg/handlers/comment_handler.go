@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"social-nework/pkg/models"
@@ -42,6 +43,17 @@ func NewComment(db *sql.DB) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		// Comments are only visible to those who can see the post
+		if err := models.CheckPostVisible(db, ctx, userID, postID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found or access denied", http.StatusNotFound)
+				return
+			}
+			log.Printf("ERROR: Failed to check post visibility: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
 		var req struct {
 			Content  string  `json:"content"`
 			ImageURL *string `json:"image_url,omitempty"`
@@ -58,7 +70,7 @@ func NewComment(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		comment, err := models.CreateComment(db, ctx, postID, userID, req.Content, req.ImageURL)
+		comment, err := models.CreateComment(db, ctx, postID, userID, req.Content, req.ImageURL, nil)
 		if err != nil {
 			http.Error(w, "Error creating comment", http.StatusInternalServerError)
 			return
@@ -73,7 +85,9 @@ func NewComment(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// GetPostComments retrieves all comments for a specific post
+// GetPostComments retrieves the comment tree of a post. Query parameters:
+// depth (reply levels), replies (replies per comment), and parent_id with
+// offset/limit to page through the replies of a single comment.
 func GetPostComments(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("GetPostComments function being called")
@@ -82,12 +96,10 @@ func GetPostComments(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Try to get user ID, but don't require it for public posts
-		userID := ""
-		if uid := r.Context().Value("user_id"); uid != nil {
-			if uidStr, ok := uid.(string); ok {
-				userID = uidStr
-			}
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
 		}
 
 		// Get post_id from URL parameters
@@ -101,7 +113,24 @@ func GetPostComments(db *sql.DB) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		comments, err := models.GetPostComments(db, ctx, postID, userID)
+		// Comments are only visible to those who can see the post
+		if err := models.CheckPostVisible(db, ctx, userID, postID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found or access denied", http.StatusNotFound)
+				return
+			}
+			log.Printf("ERROR: Failed to check post visibility: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		opts, err := parseCommentTreeParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		comments, total, err := models.GetCommentTree(db, ctx, postID, userID, opts)
 		if err != nil {
 			log.Printf("ERROR: Failed to get comments: %v", err)
 			http.Error(w, "Error getting comments", http.StatusInternalServerError)
@@ -113,6 +142,7 @@ func GetPostComments(db *sql.DB) http.HandlerFunc {
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"comments": comments,
 			"count":    len(comments),
+			"total":    total,
 		})
 	}
 }
@@ -143,9 +173,21 @@ func CreateComment(db *sql.DB, notificationModel *models.NotificationModel, hub
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
+		// Comments are only visible to those who can see the post
+		if err := models.CheckPostVisible(db, ctx, userID, postID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found or access denied", http.StatusNotFound)
+				return
+			}
+			log.Printf("ERROR: Failed to check post visibility: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
 		var req struct {
-			Content  string  `json:"content"`
-			ImageURL *string `json:"image_url,omitempty"`
+			Content         string  `json:"content"`
+			ImageURL        *string `json:"image_url,omitempty"`
+			ParentCommentID *string `json:"parent_comment_id,omitempty"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -158,53 +200,37 @@ func CreateComment(db *sql.DB, notificationModel *models.NotificationModel, hub
 			http.Error(w, "Content is required", http.StatusBadRequest)
 			return
 		}
+		if req.ParentCommentID != nil && *req.ParentCommentID == "" {
+			req.ParentCommentID = nil
+		}
 
-		comment, err := models.CreateComment(db, ctx, postID, userID, req.Content, req.ImageURL)
+		comment, err := models.CreateComment(db, ctx, postID, userID, req.Content, req.ImageURL, req.ParentCommentID)
 		if err != nil {
+			if err == models.ErrInvalidParentComment {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, "Error creating comment", http.StatusInternalServerError)
 			return
 		}
 
-		// Create notification for post owner if different from commenter
-		var postOwnerID string
-		err = db.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = ?", postID).Scan(&postOwnerID)
-		if err == nil && postOwnerID != userID {
-			log.Printf("DEBUG: Creating comment notification - PostOwner: %s, Commenter: %s, PostID: %s", postOwnerID, userID, postID)
-			notification := models.Notification{
-				ID:          uuid.New().String(),
-				UserID:      postOwnerID,
-				Type:        "new_comment",
-				ReferenceID: postID,
-				ActorID:     &userID,    // Store who performed the action
-				IsRead:      false,
-				CreatedAt:   time.Now(),
+		// A reply notifies the author of the comment being answered
+		var parentAuthorID string
+		if req.ParentCommentID != nil {
+			err = db.QueryRowContext(ctx, "SELECT user_id FROM comments WHERE id = ?", *req.ParentCommentID).Scan(&parentAuthorID)
+			if err != nil {
+				log.Printf("ERROR: Failed to get parent comment author for reply notification: %v", err)
+			} else if parentAuthorID != userID {
+				notifyComment(ctx, db, notificationModel, hub, parentAuthorID, "comment_reply", postID, comment.ID, userID)
 			}
+		}
 
-			if notificationModel != nil {
-				_, err = notificationModel.Insert(ctx, notification)
-				if err != nil {
-					log.Printf("ERROR: Failed to create comment notification: %v", err)
-				} else {
-					log.Printf("SUCCESS: Comment notification created for post owner: %s", postOwnerID)
-					
-					// Send real-time notification
-					if hub != nil {
-						log.Printf("DEBUG: Sending real-time comment notification to user: %s", postOwnerID)
-						
-						// Get commenter info
-						var commenterNickname, commenterAvatar string
-						db.QueryRowContext(ctx, "SELECT nickname, avatar_url FROM users WHERE id = ?", userID).Scan(&commenterNickname, &commenterAvatar)
-						
-						hub.SendNotification(postOwnerID, notification, map[string]interface{}{
-							"post_id":        postID,
-							"comment_id":     comment.ID,
-							"commenter_id":   userID,
-							"actor_nickname": commenterNickname,
-							"actor_avatar":   commenterAvatar,
-						})
-					}
-				}
-			}
+		// Create notification for post owner if different from commenter,
+		// unless they were already notified of the reply above
+		var postOwnerID string
+		err = db.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = ?", postID).Scan(&postOwnerID)
+		if err == nil && postOwnerID != userID && postOwnerID != parentAuthorID {
+			notifyComment(ctx, db, notificationModel, hub, postOwnerID, "new_comment", postID, comment.ID, userID)
 		} else if err != nil {
 			log.Printf("ERROR: Failed to get post owner for comment notification: %v", err)
 		} else {
@@ -219,3 +245,194 @@ func CreateComment(db *sql.DB, notificationModel *models.NotificationModel, hub
 		})
 	}
 }
+
+// UpdateComment lets the author edit their comment
+func UpdateComment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		commentID := mux.Vars(r)["comment_id"]
+		if commentID == "" {
+			http.Error(w, "Comment ID is required", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Content  string  `json:"content"`
+			ImageURL *string `json:"image_url,omitempty"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if req.Content == "" {
+			http.Error(w, "Content is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if !checkCommentAccess(w, db, ctx, userID, commentID) {
+			return
+		}
+
+		comment, err := models.UpdateComment(db, ctx, commentID, userID, req.Content, req.ImageURL)
+		if err != nil {
+			writeCommentError(w, "update", commentID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": "Comment updated successfully",
+			"comment": comment,
+		})
+	}
+}
+
+// DeleteComment soft deletes a comment for its author, the post author or a group admin
+func DeleteComment(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		commentID := mux.Vars(r)["comment_id"]
+		if commentID == "" {
+			http.Error(w, "Comment ID is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if !checkCommentAccess(w, db, ctx, userID, commentID) {
+			return
+		}
+
+		if err := models.DeleteComment(db, ctx, commentID, userID); err != nil {
+			writeCommentError(w, "delete", commentID, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted successfully"})
+	}
+}
+
+// checkCommentAccess writes a 404 unless the user can see the comment's post
+func checkCommentAccess(w http.ResponseWriter, db *sql.DB, ctx context.Context, userID, commentID string) bool {
+	if err := models.CheckCommentVisible(db, ctx, userID, commentID); err != nil {
+		if err == models.ErrPostNotFound {
+			http.Error(w, "Comment not found or access denied", http.StatusNotFound)
+			return false
+		}
+		log.Printf("ERROR: Failed to check comment visibility: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// writeCommentError maps comment model errors to HTTP responses
+func writeCommentError(w http.ResponseWriter, action, commentID string, err error) {
+	switch err {
+	case models.ErrCommentNotFound:
+		http.Error(w, "Comment not found", http.StatusNotFound)
+	case models.ErrCommentForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		log.Printf("ERROR: Failed to %s comment %s: %v", action, commentID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// notifyComment stores a comment notification and pushes it to the recipient in real time
+func notifyComment(ctx context.Context, db *sql.DB, notificationModel *models.NotificationModel, hub *websocket.Hub, recipientID, notifType, postID, commentID, actorID string) {
+	if notificationModel == nil {
+		return
+	}
+
+	log.Printf("DEBUG: Creating %s notification - Recipient: %s, Commenter: %s, PostID: %s", notifType, recipientID, actorID, postID)
+	notification := models.Notification{
+		ID:          uuid.New().String(),
+		UserID:      recipientID,
+		Type:        notifType,
+		ReferenceID: postID,
+		ActorID:     &actorID, // Store who performed the action
+		IsRead:      false,
+		CreatedAt:   time.Now(),
+	}
+
+	if _, err := notificationModel.Insert(ctx, notification); err != nil {
+		log.Printf("ERROR: Failed to create %s notification: %v", notifType, err)
+		return
+	}
+
+	// Send real-time notification
+	if hub != nil {
+		// Get commenter info
+		var commenterNickname, commenterAvatar string
+		db.QueryRowContext(ctx, "SELECT nickname, avatar_url FROM users WHERE id = ?", actorID).Scan(&commenterNickname, &commenterAvatar)
+
+		hub.SendNotification(recipientID, notification, map[string]interface{}{
+			"post_id":        postID,
+			"comment_id":     commentID,
+			"commenter_id":   actorID,
+			"actor_nickname": commenterNickname,
+			"actor_avatar":   commenterAvatar,
+		})
+	}
+}
+
+// parseCommentTreeParams reads the comment tree query parameters
+func parseCommentTreeParams(r *http.Request) (models.CommentTreeOptions, error) {
+	opts := models.CommentTreeOptions{
+		Depth:   models.DefaultCommentDepth,
+		Replies: models.DefaultRepliesPerNode,
+	}
+	query := r.URL.Query()
+
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"depth", &opts.Depth},
+		{"replies", &opts.Replies},
+		{"offset", &opts.Offset},
+		{"limit", &opts.Limit},
+	}
+	for _, p := range ints {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid %s", p.name)
+		}
+		*p.dst = n
+	}
+
+	if parentID := query.Get("parent_id"); parentID != "" {
+		opts.ParentID = &parentID
+	}
+	return opts, nil
+}
@@ -50,9 +50,20 @@ func (h *FollowHandler) Follow(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	blocked, err := models.IsBlocked(h.DB, ctx, followerID, followedID)
+	if err != nil {
+		log.Printf("Failed to check blocks: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "Cannot follow this user", http.StatusForbidden)
+		return
+	}
+
 	// Check if the user being followed has a private profile
 	var isPrivate bool
-	err := h.DB.QueryRowContext(ctx, "SELECT is_private FROM users WHERE id = ?", followedID).Scan(&isPrivate)
+	err = h.DB.QueryRowContext(ctx, "SELECT is_private FROM users WHERE id = ?", followedID).Scan(&isPrivate)
 	if err != nil {
 		log.Printf("Failed to check user privacy: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -301,8 +312,19 @@ func (h *FollowHandler) AcceptFollowRequest(w http.ResponseWriter, r *http.Reque
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	blocked, err := models.IsBlocked(h.DB, ctx, userID, followerID)
+	if err != nil {
+		log.Printf("Failed to check blocks: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "Cannot accept this follow request", http.StatusForbidden)
+		return
+	}
+
 	// Create the follow relationship
-	err := h.FollowModel.Follow(ctx, followerID, userID)
+	err = h.FollowModel.Follow(ctx, followerID, userID)
 	if err != nil {
 		log.Printf("Failed to create follow relationship: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
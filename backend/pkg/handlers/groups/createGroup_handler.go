@@ -121,10 +121,10 @@ func (h *GroupHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
 			notification := websocket.MessagePayload{
 				Type:   "member_joined",
 				ChatID: chatID,
-				Data: map[string]interface{}{
-					"user_id":   userID,
-					"group_id":  groupID,
-					"timestamp": time.Now(),
+				Data: websocket.MemberData{
+					UserID:    userID,
+					GroupID:   groupID,
+					Timestamp: time.Now(),
 				},
 			}
 			h.h.BroadcastToChatRoom(chatID, notification, userID)
@@ -184,10 +184,10 @@ func (h *GroupHandler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
 		notification := websocket.MessagePayload{
 			Type:   "member_left",
 			ChatID: chatID,
-			Data: map[string]interface{}{
-				"user_id":   userID,
-				"group_id":  groupID,
-				"timestamp": time.Now(),
+			Data: websocket.MemberData{
+				UserID:    userID,
+				GroupID:   groupID,
+				Timestamp: time.Now(),
 			},
 		}
 		h.h.BroadcastToChatRoom(chatID, notification, "")
@@ -1,6 +1,7 @@
 package groups
 
 import (
+	"database/sql"
 	"encoding/json"
 	"net/http"
 	"social-nework/pkg/models"
@@ -12,7 +13,11 @@ import (
 func (gh *GroupHandler) GetGroupPosts(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	groupID := vars["groupId"]
-	userID := r.URL.Query().Get("user_id")
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 
 	// Check if user is member of the group
 	memberQuery := `SELECT id FROM group_members WHERE group_id = ? AND user_id = ? AND deleted_at IS NULL`
@@ -23,13 +28,15 @@ func (gh *GroupHandler) GetGroupPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	query := `SELECT p.id, p.user_id, p.group_id, p.content, p.privacy, p.created_at, p.updated_at 
+	// Members who blocked one another don't see each other's posts
+	blocked, blockedArgs := models.BlockedSQL("p.user_id", userID)
+	query := `SELECT p.id, p.user_id, p.group_id, p.content, p.privacy, p.created_at, p.updated_at, p.edited_at 
 			  FROM posts p 
 			  INNER JOIN group_posts gp ON p.id = gp.post_id 
-			  WHERE gp.group_id = ? AND p.deleted_at IS NULL 
+			  WHERE gp.group_id = ? AND p.deleted_at IS NULL AND NOT ` + blocked + `
 			  ORDER BY p.created_at DESC`
 
-	rows, err := gh.db.Query(query, groupID)
+	rows, err := gh.db.Query(query, append([]interface{}{groupID}, blockedArgs...)...)
 	if err != nil {
 		http.Error(w, "Failed to fetch posts", http.StatusInternalServerError)
 		return
@@ -39,13 +46,26 @@ func (gh *GroupHandler) GetGroupPosts(w http.ResponseWriter, r *http.Request) {
 	var posts []models.Post
 	for rows.Next() {
 		var post models.Post
+		var editedAt sql.NullInt64
 		err := rows.Scan(&post.ID, &post.UserID, &post.GroupID, &post.Content,
-			&post.Privacy, &post.CreatedAt, &post.UpdatedAt)
+			&post.Privacy, &post.CreatedAt, &post.UpdatedAt, &editedAt)
 		if err != nil {
 			continue
 		}
+		if editedAt.Valid {
+			post.EditedAt = &editedAt.Int64
+			post.Edited = true
+		}
 		posts = append(posts, post)
 	}
+	if err := models.AttachPostReactions(gh.db, r.Context(), userID, posts); err != nil {
+		http.Error(w, "Failed to fetch reactions", http.StatusInternalServerError)
+		return
+	}
+	if err := models.AttachPostMedia(gh.db, r.Context(), posts); err != nil {
+		http.Error(w, "Failed to fetch media", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(posts)
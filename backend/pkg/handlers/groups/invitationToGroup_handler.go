@@ -51,6 +51,16 @@ func (gh *GroupHandler) InviteToGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	blocked, err := models.IsBlocked(gh.db, r.Context(), invitation.InviterID, invitation.InviteeID)
+	if err != nil {
+		http.Error(w, "Failed to send invitation", http.StatusInternalServerError)
+		return
+	}
+	if blocked {
+		http.Error(w, "Cannot invite this user", http.StatusForbidden)
+		return
+	}
+
 	invitation.ID = uuid.New().String()
 	invitation.EntityType = "group"
 	invitation.Status = "pending"
@@ -35,7 +35,7 @@ func (gh *GroupHandler) RespondToInvitation(w http.ResponseWriter, r *http.Reque
 	}
 
 	// Update invitation status
-	updateQuery := `UPDATE invitations SET status = ? WHERE id = ?`
+	updateQuery := `UPDATE invitations SET status = ? WHERE id = ? AND deleted_at IS NULL`
 	_, err := gh.db.Exec(updateQuery, response.Status, invitationID)
 	if err != nil {
 		http.Error(w, "Failed to update invitation", http.StatusInternalServerError)
@@ -43,7 +43,7 @@ func (gh *GroupHandler) RespondToInvitation(w http.ResponseWriter, r *http.Reque
 	}
 
 	var invitation models.Invitation
-	inviteQuery := `SELECT inviter_id, invitee_id, entity_id FROM invitations WHERE id = ?`
+	inviteQuery := `SELECT inviter_id, invitee_id, entity_id FROM invitations WHERE id = ? AND deleted_at IS NULL`
 	err = gh.db.QueryRow(inviteQuery, invitationID).Scan(&invitation.InviterID, &invitation.InviteeID, &invitation.EntityID)
 	if err != nil {
 		http.Error(w, "Invitation not found", http.StatusNotFound)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -35,34 +36,16 @@ func LikeComment(db *sql.DB, notificationModel *models.NotificationModel, hub *w
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		// Check if the comment exists and user has access to it
-		var commentExists bool
-		checkStmt := `
-			SELECT EXISTS(
-				SELECT 1 FROM comments c
-				JOIN posts p ON c.post_id = p.id
-				WHERE c.id = ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL AND (
-					p.privacy = 'public' OR
-					p.user_id = ? OR
-					c.user_id = ? OR
-					(p.privacy = 'almost_private' AND EXISTS(
-						SELECT 1 FROM follows 
-						WHERE follower_id = ? AND followed_id = p.user_id AND status = 'accepted'
-					))
-				)
-			)
-		`
-		err := db.QueryRowContext(ctx, checkStmt, commentID, userID, userID, userID).Scan(&commentExists)
-		if err != nil {
+		// Check if the comment exists and user has access to its post
+		if err := models.CheckCommentVisible(db, ctx, userID, commentID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Comment not found or access denied", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		if !commentExists {
-			http.Error(w, "Comment not found or access denied", http.StatusNotFound)
-			return
-		}
-
 		// Check if we're liking or unliking
 		isLike := r.Method == http.MethodPost
 
@@ -71,7 +54,7 @@ func LikeComment(db *sql.DB, notificationModel *models.NotificationModel, hub *w
 			like, err := models.CreateLike(db, ctx, notificationModel, hub, userID, "comment", commentID)
 			if err != nil {
 				// If the error is because user already liked the comment, return a specific status code
-				if err.Error() == "user already liked this content" {
+				if errors.Is(err, models.ErrAlreadyReacted) {
 					http.Error(w, err.Error(), http.StatusConflict)
 					return
 				}
@@ -89,7 +72,7 @@ func LikeComment(db *sql.DB, notificationModel *models.NotificationModel, hub *w
 			// Unlike the comment
 			err := models.UnlikeContent(db, ctx, userID, "comment", commentID)
 			if err != nil {
-				if err.Error() == "like not found or already removed" {
+				if errors.Is(err, models.ErrLikeNotFound) {
 					http.Error(w, err.Error(), http.StatusNotFound)
 					return
 				}
@@ -128,34 +111,16 @@ func GetCommentLikes(db *sql.DB) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		// Check if the comment exists and user has access to it
-		var commentExists bool
-		checkStmt := `
-			SELECT EXISTS(
-				SELECT 1 FROM comments c
-				JOIN posts p ON c.post_id = p.id
-				WHERE c.id = ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL AND (
-					p.privacy = 'public' OR
-					p.user_id = ? OR
-					c.user_id = ? OR
-					(p.privacy = 'almost_private' AND EXISTS(
-						SELECT 1 FROM follows 
-						WHERE follower_id = ? AND followed_id = p.user_id AND status = 'accepted'
-					))
-				)
-			)
-		`
-		err := db.QueryRowContext(ctx, checkStmt, commentID, userID, userID, userID).Scan(&commentExists)
-		if err != nil {
+		// Check if the comment exists and user has access to its post
+		if err := models.CheckCommentVisible(db, ctx, userID, commentID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Comment not found or access denied", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		if !commentExists {
-			http.Error(w, "Comment not found or access denied", http.StatusNotFound)
-			return
-		}
-
 		// Get all likes for the comment
 		likes, err := models.GetCommentLikes(db, ctx, commentID)
 		if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 
@@ -36,31 +37,15 @@ func LikePost(db *sql.DB, notificationModel *models.NotificationModel, hub *webs
 		defer cancel()
 
 		// Check if the post exists and user has access to it
-		var postExists bool
-		checkStmt := `
-			SELECT EXISTS(
-				SELECT 1 FROM posts 
-				WHERE id = ? AND deleted_at IS NULL AND (
-					privacy = 'public' OR
-					user_id = ? OR
-					(privacy = 'almost_private' AND EXISTS(
-						SELECT 1 FROM follows 
-						WHERE follower_id = ? AND followed_id = posts.user_id AND status = 'accepted'
-					))
-				)
-			)
-		`
-		err := db.QueryRowContext(ctx, checkStmt, postID, userID, userID).Scan(&postExists)
-		if err != nil {
+		if err := models.CheckPostVisible(db, ctx, userID, postID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found or access denied", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		if !postExists {
-			http.Error(w, "Post not found or access denied", http.StatusNotFound)
-			return
-		}
-
 		// Check if we're liking or unliking
 		isLike := r.Method == http.MethodPost
 
@@ -69,7 +54,7 @@ func LikePost(db *sql.DB, notificationModel *models.NotificationModel, hub *webs
 			like, err := models.CreateLike(db, ctx, notificationModel, hub, userID, "post", postID)
 			if err != nil {
 				// If the error is because user already liked the post, return a specific status code
-				if err.Error() == "user already liked this content" {
+				if errors.Is(err, models.ErrAlreadyReacted) {
 					http.Error(w, err.Error(), http.StatusConflict)
 					return
 				}
@@ -87,7 +72,7 @@ func LikePost(db *sql.DB, notificationModel *models.NotificationModel, hub *webs
 			// Unlike the post
 			err := models.UnlikeContent(db, ctx, userID, "post", postID)
 			if err != nil {
-				if err.Error() == "like not found or already removed" {
+				if errors.Is(err, models.ErrLikeNotFound) {
 					http.Error(w, err.Error(), http.StatusNotFound)
 					return
 				}
@@ -127,31 +112,15 @@ func GetPostLikes(db *sql.DB) http.HandlerFunc {
 		defer cancel()
 
 		// Check if the post exists and user has access to it
-		var postExists bool
-		checkStmt := `
-			SELECT EXISTS(
-				SELECT 1 FROM posts 
-				WHERE id = ? AND deleted_at IS NULL AND (
-					privacy = 'public' OR
-					user_id = ? OR
-					(privacy = 'almost_private' AND EXISTS(
-						SELECT 1 FROM follows 
-						WHERE follower_id = ? AND followed_id = posts.user_id AND status = 'accepted'
-					))
-				)
-			)
-		`
-		err := db.QueryRowContext(ctx, checkStmt, postID, userID, userID).Scan(&postExists)
-		if err != nil {
+		if err := models.CheckPostVisible(db, ctx, userID, postID); err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found or access denied", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Database error", http.StatusInternalServerError)
 			return
 		}
 
-		if !postExists {
-			http.Error(w, "Post not found or access denied", http.StatusNotFound)
-			return
-		}
-
 		// Get all likes for the post
 		likes, err := models.GetPostLikes(db, ctx, postID)
 		if err != nil {
@@ -205,9 +174,10 @@ func GetUserLikedPosts(db *sql.DB) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		// Query to get posts liked by the target user
+		// Query to get posts liked by the target user that the viewer may see
+		visible, visibleArgs := models.PostVisibleSQL("p", userID)
 		stmt := `
-			SELECT p.id, p.user_id, p.content, p.privacy, p.created_at,
+			SELECT p.id, p.user_id, p.content, p.privacy, p.created_at, p.edited_at,
 				(SELECT COUNT(*) FROM likes 
 				WHERE likeable_type = 'post' AND likeable_id = p.id AND deleted_at IS NULL) as likes_count,
 				EXISTS(SELECT 1 FROM likes 
@@ -216,19 +186,12 @@ func GetUserLikedPosts(db *sql.DB) http.HandlerFunc {
 			FROM posts p
 			JOIN likes l ON p.id = l.likeable_id
 			WHERE l.likeable_type = 'post' AND l.user_id = ? AND l.deleted_at IS NULL
-			AND p.deleted_at IS NULL
-			AND (
-				p.privacy = 'public' OR
-				p.user_id = ? OR
-				(p.privacy = 'almost_private' AND EXISTS(
-					SELECT 1 FROM follows 
-					WHERE follower_id = ? AND followed_id = p.user_id AND status = 'accepted'
-				))
-			)
+			AND ` + visible + `
 			ORDER BY l.created_at DESC
 		`
+		args := append([]interface{}{userID, targetUserID}, visibleArgs...)
 
-		rows, err := db.QueryContext(ctx, stmt, userID, targetUserID, userID, userID)
+		rows, err := db.QueryContext(ctx, stmt, args...)
 		if err != nil {
 			http.Error(w, "Error getting liked posts: "+err.Error(), http.StatusInternalServerError)
 			return
@@ -238,17 +201,30 @@ func GetUserLikedPosts(db *sql.DB) http.HandlerFunc {
 		var posts []models.Post
 		for rows.Next() {
 			var post models.Post
-			err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.Privacy, &post.CreatedAt, &post.LikesCount, &post.UserLiked)
+			var editedAt sql.NullInt64
+			err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.Privacy, &post.CreatedAt, &editedAt, &post.LikesCount, &post.UserLiked)
 			if err != nil {
 				http.Error(w, "Error processing posts: "+err.Error(), http.StatusInternalServerError)
 				return
 			}
+			if editedAt.Valid {
+				post.EditedAt = &editedAt.Int64
+				post.Edited = true
+			}
 			posts = append(posts, post)
 		}
 
 		if posts == nil {
 			posts = []models.Post{}
 		}
+		if err := models.AttachPostReactions(db, ctx, userID, posts); err != nil {
+			http.Error(w, "Error getting reactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := models.AttachPostMedia(db, ctx, posts); err != nil {
+			http.Error(w, "Error getting media: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
 
 		// Return response
 		w.Header().Set("Content-Type", "application/json")
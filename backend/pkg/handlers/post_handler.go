@@ -4,9 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"social-nework/pkg/models"
@@ -29,19 +31,24 @@ func NewPost(db *sql.DB) http.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		var reqBody struct {
-			Content        string   `json:"content"`
-			Privacy        string   `json:"privacy"`
-			GroupID        *string  `json:"group_id"`
-			AllowedUserIDs []string `json:"allowed_user_ids"`
-			ImageURL       *string  `json:"image_url"`
+			Content        string                  `json:"content"`
+			Privacy        string                  `json:"privacy"`
+			GroupID        *string                 `json:"group_id"`
+			AllowedUserIDs []string                `json:"allowed_user_ids"`
+			ImageURL       *string                 `json:"image_url"`
+			Media          []models.PostMediaInput `json:"media"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
 			http.Error(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
-		_, err := models.CreatePost(db, ctx, userID, reqBody.Content, reqBody.Privacy, reqBody.GroupID, reqBody.AllowedUserIDs, reqBody.ImageURL)
+		_, err := models.CreatePost(db, ctx, userID, reqBody.Content, reqBody.Privacy, reqBody.GroupID, reqBody.AllowedUserIDs, reqBody.ImageURL, reqBody.Media)
 		if err != nil {
 			fmt.Print(err)
+			if isPostValidationError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
 			http.Error(w, "Error creating Post", http.StatusBadRequest)
 			return
 		}
@@ -73,7 +80,8 @@ func FollowingPosts(db *sql.DB) http.HandlerFunc {
 	}
 }
 
-// Get all posts
+// Get all posts visible to the user as a plain array. Kept for older clients;
+// it walks every page of the feed, so new clients should page through Feed.
 func AllPosts(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -88,11 +96,23 @@ func AllPosts(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
-		// Get all posts
-		posts, err := models.GetAllPosts(db, userID)
-		if err != nil {
-			http.Error(w, "Error getting posts", http.StatusInternalServerError)
-			return
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		posts := []models.Post{}
+		var cursor *models.FeedCursor
+		for {
+			page, next, err := models.GetFeed(db, ctx, userID, cursor, models.MaxFeedLimit)
+			if err != nil {
+				log.Printf("ERROR: Failed to get posts for user %s: %v", userID, err)
+				http.Error(w, "Error getting posts", http.StatusInternalServerError)
+				return
+			}
+			posts = append(posts, page...)
+			if next == nil {
+				break
+			}
+			cursor = next
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -101,6 +121,74 @@ func AllPosts(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// Feed returns one page of the user's home feed along with the cursor for the next page
+func Feed(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		cursor, limit, err := parseFeedParams(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		posts, next, err := models.GetFeed(db, ctx, userID, cursor, limit)
+		if err != nil {
+			log.Printf("ERROR: Failed to get feed for user %s: %v", userID, err)
+			http.Error(w, "Error getting feed", http.StatusInternalServerError)
+			return
+		}
+
+		var nextCursor *string
+		if next != nil {
+			encoded := next.Encode()
+			nextCursor = &encoded
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"posts":       posts,
+			"next_cursor": nextCursor,
+			"has_more":    next != nil,
+		})
+	}
+}
+
+// parseFeedParams reads the optional limit and cursor query parameters
+func parseFeedParams(r *http.Request) (*models.FeedCursor, int, error) {
+	limit := models.DefaultFeedLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return nil, 0, fmt.Errorf("invalid limit")
+		}
+		limit = n
+	}
+
+	var cursor *models.FeedCursor
+	if raw := r.URL.Query().Get("cursor"); raw != "" {
+		c, err := models.DecodeFeedCursor(raw)
+		if err != nil {
+			return nil, 0, err
+		}
+		cursor = c
+	}
+
+	return cursor, limit, nil
+}
+
 func DeletPost(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value("user_id").(string)
@@ -110,6 +198,10 @@ func DeletPost(db *sql.DB) http.HandlerFunc {
 		err := models.DeletePost(db, postID, userID)
 
 		if err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found or not owned by user", http.StatusNotFound)
+				return
+			}
 			http.Error(w, "Error deleting post: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -119,6 +211,47 @@ func DeletPost(db *sql.DB) http.HandlerFunc {
 	}
 }
 
+// RestorePost brings back a post the user deleted, as long as it has not been purged
+func RestorePost(db *sql.DB, window time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		postID := mux.Vars(r)["post_id"]
+		if postID == "" {
+			http.Error(w, "Post ID is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := models.RestorePost(db, ctx, postID, userID, window); err != nil {
+			switch err {
+			case models.ErrPostNotFound:
+				http.Error(w, "Deleted post not found", http.StatusNotFound)
+			case models.ErrRestoreWindowPassed:
+				http.Error(w, err.Error(), http.StatusGone)
+			default:
+				log.Printf("ERROR: Failed to restore post %s: %v", postID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Post restored successfully"})
+	}
+}
+
 // GetSinglePost retrieves a single post by ID
 func GetSinglePost(db *sql.DB) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -144,28 +277,26 @@ func GetSinglePost(db *sql.DB) http.HandlerFunc {
 		defer cancel()
 
 		// Query to get the post with privacy checks
+		visible, visibleArgs := models.PostVisibleSQL("p", userID)
 		query := `
-			SELECT p.id, p.user_id, p.content, p.privacy, p.created_at,
+			SELECT p.id, p.user_id, p.group_id, p.content, p.privacy, p.image_url,
+				p.created_at, p.updated_at, p.edited_at,
 				(SELECT COUNT(*) FROM likes 
 				WHERE likeable_type = 'post' AND likeable_id = p.id AND deleted_at IS NULL) as likes_count,
 				EXISTS(SELECT 1 FROM likes 
 						WHERE likeable_type = 'post' AND likeable_id = p.id 
 						AND user_id = ? AND deleted_at IS NULL) as user_liked
 			FROM posts p
-			WHERE p.id = ? AND p.deleted_at IS NULL AND (
-				p.privacy = 'public' OR
-				p.user_id = ? OR
-				(p.privacy = 'almost_private' AND EXISTS(
-					SELECT 1 FROM follows 
-					WHERE follower_id = ? AND followed_id = p.user_id AND status = 'accepted'
-				))
-			)
+			WHERE p.id = ? AND ` + visible + `
 		`
+		args := append([]interface{}{userID, postID}, visibleArgs...)
 
 		var post models.Post
-		err := db.QueryRowContext(ctx, query, userID, postID, userID, userID).Scan(
-			&post.ID, &post.UserID, &post.Content, &post.Privacy,
-			&post.CreatedAt, &post.LikesCount, &post.UserLiked,
+		var groupID, imageURL sql.NullString
+		var editedAt sql.NullInt64
+		err := db.QueryRowContext(ctx, query, args...).Scan(
+			&post.ID, &post.UserID, &groupID, &post.Content, &post.Privacy, &imageURL,
+			&post.CreatedAt, &post.UpdatedAt, &editedAt, &post.LikesCount, &post.UserLiked,
 		)
 
 		if err != nil {
@@ -177,8 +308,157 @@ func GetSinglePost(db *sql.DB) http.HandlerFunc {
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if groupID.Valid {
+			post.GroupID = &groupID.String
+		}
+		if imageURL.Valid {
+			post.ImageURL = &imageURL.String
+		}
+		if editedAt.Valid {
+			post.EditedAt = &editedAt.Int64
+			post.Edited = true
+		}
+
+		posts := []models.Post{post}
+		if err := models.AttachPostReactions(db, ctx, userID, posts); err != nil {
+			log.Printf("Error fetching reactions: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := models.AttachPostMedia(db, ctx, posts); err != nil {
+			log.Printf("Error fetching media: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(posts[0])
+	}
+}
+
+// UpdatePost lets the author edit a post's content, image and privacy
+func UpdatePost(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		postID := mux.Vars(r)["post_id"]
+		if postID == "" {
+			http.Error(w, "Post ID is required", http.StatusBadRequest)
+			return
+		}
+
+		var reqBody struct {
+			Content        string                  `json:"content"`
+			Privacy        string                  `json:"privacy"`
+			AllowedUserIDs []string                `json:"allowed_user_ids"`
+			ImageURL       *string                 `json:"image_url"`
+			Media          []models.PostMediaInput `json:"media"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err := models.UpdatePost(db, ctx, postID, userID, reqBody.Content, reqBody.Privacy, reqBody.AllowedUserIDs, reqBody.ImageURL, reqBody.Media)
+		if err != nil {
+			switch err {
+			case models.ErrPostNotFound:
+				http.Error(w, "Post not found", http.StatusNotFound)
+			case models.ErrNotPostAuthor:
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				if isPostValidationError(err) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				log.Printf("ERROR: Failed to update post %s: %v", postID, err)
+				http.Error(w, "Error updating post", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Post updated successfully"})
+	}
+}
+
+// GetPostRevisions lists the previous versions of the author's own post
+func GetPostRevisions(db *sql.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		postID := mux.Vars(r)["post_id"]
+		if postID == "" {
+			http.Error(w, "Post ID is required", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Earlier versions may have had a different audience, so only the author sees them
+		post, _, err := models.GetPostAudience(db, ctx, userID, postID)
+		if err != nil {
+			if err == models.ErrPostNotFound {
+				http.Error(w, "Post not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("ERROR: Failed to load post %s: %v", postID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if post.UserID != userID || post.DeletedAt != nil {
+			http.Error(w, "Post not found", http.StatusNotFound)
+			return
+		}
+
+		revisions, err := models.GetPostRevisions(db, ctx, postID)
+		if err != nil {
+			log.Printf("ERROR: Failed to get revisions for post %s: %v", postID, err)
+			http.Error(w, "Error getting revisions", http.StatusInternalServerError)
+			return
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(post)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"revisions": revisions,
+			"count":     len(revisions),
+		})
+	}
+}
+
+// isPostValidationError reports whether err is a post or gallery validation
+// error whose message is meant for the client
+func isPostValidationError(err error) bool {
+	for _, target := range []error{
+		models.ErrEmptyPost, models.ErrInvalidPrivacy, models.ErrNoAllowedUsers,
+		models.ErrTooManyMedia, models.ErrMissingMediaID, models.ErrMediaNotOwned,
+		models.ErrDuplicateMedia, models.ErrAltTextTooLong,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
 	}
+	return false
 }
@@ -43,6 +43,22 @@ func GetProfile(db *sql.DB) http.HandlerFunc {
 			"following_count": len(following),
 		}
 
+		// Whether the viewer blocked or muted this user, never the reverse
+		if targetID != userID {
+			blocked, muted, err := models.GetBlockStatus(db, r.Context(), userID, targetID)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"success": false,
+					"error":   err.Error(),
+				})
+				return
+			}
+			response["blocked"] = blocked
+			response["muted"] = muted
+		}
+
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
 		json.NewEncoder(w).Encode(map[string]interface{}{
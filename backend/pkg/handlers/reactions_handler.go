@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"social-nework/pkg/models"
+	"social-nework/pkg/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultReactorsLimit = 50
+	maxReactorsLimit     = 200
+)
+
+// React sets the user's reaction on a post or comment ("post" or "comment" as likeableType)
+func React(db *sql.DB, notificationModel *models.NotificationModel, hub *websocket.Hub, likeableType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var req struct {
+			Reaction string `json:"reaction"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		likeableID, ok := reactionTarget(w, r, db, ctx, userID, likeableType)
+		if !ok {
+			return
+		}
+
+		like, err := models.React(db, ctx, notificationModel, hub, userID, likeableType, likeableID, req.Reaction)
+		if err != nil {
+			switch err {
+			case models.ErrInvalidReaction:
+				http.Error(w, "Invalid reaction", http.StatusBadRequest)
+			case models.ErrAlreadyReacted:
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, "Error reacting: "+err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":  "Reaction saved",
+			"reaction": like,
+		})
+	}
+}
+
+// RemoveReaction removes the user's reaction from a post or comment
+func RemoveReaction(db *sql.DB, likeableType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		likeableID, ok := reactionTarget(w, r, db, ctx, userID, likeableType)
+		if !ok {
+			return
+		}
+
+		if err := models.UnlikeContent(db, ctx, userID, likeableType, likeableID); err != nil {
+			if errors.Is(err, models.ErrLikeNotFound) {
+				http.Error(w, "Reaction not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Error removing reaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Reaction removed",
+		})
+	}
+}
+
+// GetReactions lists who reacted to a post or comment, optionally filtered with ?reaction=
+func GetReactions(db *sql.DB, likeableType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query := r.URL.Query()
+		reaction := query.Get("reaction")
+		if reaction != "" && !models.IsValidReaction(reaction) {
+			http.Error(w, "Invalid reaction", http.StatusBadRequest)
+			return
+		}
+		limit, offset := defaultReactorsLimit, 0
+		if v := query.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxReactorsLimit)
+		}
+		if v := query.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid offset", http.StatusBadRequest)
+				return
+			}
+			offset = n
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		likeableID, ok := reactionTarget(w, r, db, ctx, userID, likeableType)
+		if !ok {
+			return
+		}
+
+		reactors, err := models.GetReactors(db, ctx, userID, likeableType, likeableID, reaction, limit, offset)
+		if err != nil {
+			http.Error(w, "Error getting reactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		counts, err := models.GetReactionCounts(db, ctx, likeableType, []string{likeableID})
+		if err != nil {
+			http.Error(w, "Error counting reactions: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		mine, err := models.GetUserReactions(db, ctx, userID, likeableType, []string{likeableID})
+		if err != nil {
+			http.Error(w, "Error checking reaction: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"reactors":  reactors,
+			"counts":    counts[likeableID],
+			"available": models.Reactions(),
+		}
+		if r, ok := mine[likeableID]; ok {
+			response["user_reaction"] = r
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// reactionTarget reads the post or comment ID from the URL and checks the user can see it.
+// It writes the error response and returns false when they cannot.
+func reactionTarget(w http.ResponseWriter, r *http.Request, db *sql.DB, ctx context.Context, userID, likeableType string) (string, bool) {
+	vars := mux.Vars(r)
+	if likeableType == "comment" {
+		commentID := vars["comment_id"]
+		if commentID == "" {
+			http.Error(w, "Comment ID is required", http.StatusBadRequest)
+			return "", false
+		}
+		return commentID, checkCommentAccess(w, db, ctx, userID, commentID)
+	}
+
+	postID := vars["post_id"]
+	if postID == "" {
+		http.Error(w, "Post ID is required", http.StatusBadRequest)
+		return "", false
+	}
+	if err := models.CheckPostVisible(db, ctx, userID, postID); err != nil {
+		if err == models.ErrPostNotFound {
+			http.Error(w, "Post not found or access denied", http.StatusNotFound)
+			return "", false
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return "", false
+	}
+	return postID, true
+}
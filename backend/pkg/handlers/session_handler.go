@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"social-nework/pkg/auth"
+	"social-nework/pkg/websocket"
+
+	"github.com/gorilla/mux"
+)
+
+type SessionHandler struct {
+	SessionModel *auth.SessionModel
+	Hub          *websocket.Hub // Closes the WebSockets of revoked sessions
+}
+
+// CSRFToken returns the CSRF token of the current session, for clients that
+// lost the one sent at login
+func (h *SessionHandler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.CSRFToken(w, r)
+	if err != nil {
+		log.Printf("ERROR: Failed to get CSRF token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"csrf_token": token,
+	})
+}
+
+// ListSessions returns every active session (device) of the authenticated user
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := r.Context().Value("session_id").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := h.SessionModel.ListActive(ctx, userID)
+	if err != nil {
+		log.Printf("ERROR: Failed to list sessions for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sessions": sessions,
+		"count":    len(sessions),
+	})
+}
+
+// RevokeSession logs out a single session of the authenticated user
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	sessionID := mux.Vars(r)["id"]
+	if sessionID == "" {
+		http.Error(w, "Session ID is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := h.SessionModel.Revoke(ctx, sessionID, userID); err != nil {
+		if err == auth.ErrSessionNotFound {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("ERROR: Failed to revoke session %s: %v", sessionID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.CloseSessions(userID, sessionID)
+
+	// Revoking the current session is a logout, so drop the cookie as well
+	if currentID, _ := r.Context().Value("session_id").(string); currentID == sessionID {
+		auth.ClearSession(w, r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
+// RevokeOtherSessions logs out every session except the one making the request
+func (h *SessionHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	currentID, _ := r.Context().Value("session_id").(string)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := h.SessionModel.RevokeAll(ctx, userID, currentID)
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.CloseOtherSessions(userID, currentID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"revoked": revoked,
+	})
+}
+
+// LogoutEverywhere revokes all sessions of the user, including the current one
+func (h *SessionHandler) LogoutEverywhere(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("user_id").(string)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	revoked, err := h.SessionModel.RevokeAll(ctx, userID, "")
+	if err != nil {
+		log.Printf("ERROR: Failed to revoke sessions for user %s: %v", userID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	h.Hub.CloseOtherSessions(userID, "")
+
+	if err := auth.ClearSession(w, r); err != nil {
+		log.Println("Logout error:", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Logged out from all sessions",
+		"revoked": revoked,
+	})
+}
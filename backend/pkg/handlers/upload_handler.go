@@ -1,73 +1,225 @@
 package handlers
 
 import (
-    "fmt"
-    "io"
-    "net/http"
-    "os"
-    "path/filepath"
-    "strings"
-    "time"
-
-    "github.com/google/uuid"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"social-nework/pkg/media"
+	"social-nework/pkg/models"
+	"social-nework/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 )
 
-func UploadImage(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-        http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
-    // Parse multipart form
-    err := r.ParseMultipartForm(10 << 20) // 10 MB limit
-    if err != nil {
-        http.Error(w, "Unable to parse form", http.StatusBadRequest)
-        return
-    }
-
-    file, header, err := r.FormFile("image")
-    if err != nil {
-        http.Error(w, "Unable to get file", http.StatusBadRequest)
-        return
-    }
-    defer file.Close()
-
-    // Validate file type
-    contentType := header.Header.Get("Content-Type")
-    if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "video/") {
-        http.Error(w, "Invalid file type", http.StatusBadRequest)
-        return
-    }
-
-    // Create uploads directory if it doesn't exist
-    uploadsDir := "uploads"
-    if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-        http.Error(w, "Unable to create uploads directory", http.StatusInternalServerError)
-        return
-    }
-
-    // Generate unique filename
-    ext := filepath.Ext(header.Filename)
-    filename := fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), ext)
-    filepath := filepath.Join(uploadsDir, filename)
-
-    // Create the file
-    dst, err := os.Create(filepath)
-    if err != nil {
-        http.Error(w, "Unable to create file", http.StatusInternalServerError)
-        return
-    }
-    defer dst.Close()
-
-    // Copy file content
-    _, err = io.Copy(dst, file)
-    if err != nil {
-        http.Error(w, "Unable to save file", http.StatusInternalServerError)
-        return
-    }
-
-    // Return file URL
-    fileURL := fmt.Sprintf("/uploads/%s", filename)
-    w.Header().Set("Content-Type", "application/json")
-    fmt.Fprintf(w, `{"url": "%s"}`, fileURL)
-}
\ No newline at end of file
+// MaxUploadSize is the largest image or video that can be uploaded
+const MaxUploadSize = 10 << 20
+
+// redirectCacheTime is how long a browser may reuse a redirect to a signed
+// URL, and so the file it downloaded from it, before asking again
+const redirectCacheTime = 5 * time.Minute
+
+// UploadImage stores an uploaded image or video for the user. The file's real
+// type is sniffed from its content; images are re-encoded without their
+// metadata and get medium and thumbnail variants.
+func UploadImage(db *sql.DB, store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, MaxUploadSize+1<<20)
+		file, _, err := r.FormFile("image")
+		if err != nil {
+			http.Error(w, "Unable to get file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, MaxUploadSize+1))
+		if err != nil {
+			http.Error(w, "Unable to read file", http.StatusBadRequest)
+			return
+		}
+		if len(data) > MaxUploadSize {
+			http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		upload, err := media.Process(data)
+		switch {
+		case errors.Is(err, media.ErrUnsupported):
+			http.Error(w, "Invalid file type", http.StatusUnsupportedMediaType)
+			return
+		case errors.Is(err, media.ErrPolyglot), errors.Is(err, media.ErrCorrupt), errors.Is(err, media.ErrTooLarge),
+			errors.Is(err, media.ErrTooLong):
+			log.Printf("Rejected upload from %s: %v", userID, err)
+			http.Error(w, "Invalid file: "+err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Printf("ERROR: Failed to process upload: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		m := &models.Media{
+			ID:        uuid.New().String(),
+			OwnerID:   userID,
+			Kind:      upload.Kind,
+			MimeType:  upload.Original.MimeType,
+			Size:      int64(len(upload.Original.Data)),
+			SHA256:    upload.SHA256,
+			CreatedAt: time.Now().Unix(),
+		}
+		if upload.Kind == "image" {
+			m.Width, m.Height = &upload.Original.Width, &upload.Original.Height
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		// Store every file before recording the media, removing them all on failure
+		var written []string
+		put := func(f *media.File) (string, error) {
+			name := m.ID + f.Suffix + f.Ext
+			if err := store.Put(ctx, name, bytes.NewReader(f.Data), int64(len(f.Data)), f.MimeType); err != nil {
+				return "", err
+			}
+			written = append(written, name)
+			return name, nil
+		}
+		fail := func(err error) {
+			for _, name := range written {
+				store.Delete(ctx, name)
+			}
+			log.Printf("ERROR: Failed to store upload: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+
+		if m.Filename, err = put(&upload.Original); err != nil {
+			fail(err)
+			return
+		}
+		for _, v := range []struct {
+			file *media.File
+			dst  **string
+		}{
+			{upload.Medium, &m.MediumFilename},
+			{upload.Thumbnail, &m.ThumbnailFilename},
+		} {
+			if v.file == nil {
+				continue
+			}
+			name, err := put(v.file)
+			if err != nil {
+				fail(err)
+				return
+			}
+			*v.dst = &name
+		}
+
+		if err := models.InsertMedia(db, ctx, m); err != nil {
+			fail(err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":   m.URL,
+			"media": m,
+		})
+	}
+}
+
+// ServeUpload redirects viewers who own an uploaded file, or may see something
+// that uses it, to a signed URL of the file valid for ttl. A variant is
+// visible wherever its original is.
+func ServeUpload(db *sql.DB, store storage.Backend, ttl time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(string)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		filename := mux.Vars(r)["filename"]
+		if filename == "" || filename != filepath.Base(filename) || strings.HasPrefix(filename, ".") {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// Files uploaded before media were recorded are checked by their own URL
+		m, err := models.GetMediaByFile(db, ctx, filename)
+		if err != nil && err != sql.ErrNoRows {
+			log.Printf("ERROR: Failed to get media: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		url := models.UploadsPrefix + filename
+		if m != nil {
+			url = m.URL
+		}
+
+		visible := m != nil && m.OwnerID == userID
+		if !visible {
+			visible, err = models.CanViewImage(db, ctx, userID, url)
+			if err != nil {
+				log.Printf("ERROR: Failed to check image visibility: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		if !visible {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		// Older files keep their extension; only media types are served as such
+		contentType := media.ContentType(filename)
+		if m == nil {
+			contentType = mime.TypeByExtension(filepath.Ext(filename))
+			if !strings.HasPrefix(contentType, "image/") && !strings.HasPrefix(contentType, "video/") {
+				contentType = "application/octet-stream"
+			}
+		}
+		redirectSigned(w, r, store, filename, ttl, storage.URLOptions{ContentType: contentType})
+	}
+}
+
+// redirectSigned sends the client to a signed URL of the file stored under key
+func redirectSigned(w http.ResponseWriter, r *http.Request, store storage.Backend, key string, ttl time.Duration, opts storage.URLOptions) {
+	if _, err := store.Stat(r.Context(), key); err != nil {
+		if err != storage.ErrNotFound {
+			log.Printf("ERROR: Failed to stat upload %s: %v", key, err)
+		}
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	signed, err := store.SignedURL(r.Context(), key, ttl, opts)
+	if err != nil {
+		log.Printf("ERROR: Failed to sign URL of %s: %v", key, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(min(redirectCacheTime, ttl/2).Seconds())))
+	http.Redirect(w, r, signed, http.StatusFound)
+}
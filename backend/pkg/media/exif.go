@@ -0,0 +1,64 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// exifOrientation returns the orientation tag of a JPEG's EXIF data, or 1
+// (upright) if it has none. Re-encoding drops the tag, so it is applied first.
+func exifOrientation(jpeg []byte) int {
+	const (
+		markerSOS      = 0xda
+		markerAPP1     = 0xe1
+		tagOrientation = 0x0112
+	)
+
+	data := jpeg[2:] // After the SOI marker
+	for len(data) >= 4 && data[0] == 0xff {
+		marker := data[1]
+		if marker == markerSOS {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < 2 || len(data) < 2+length {
+			break
+		}
+		segment := data[4 : 2+length]
+		data = data[2+length:]
+
+		if marker != markerAPP1 || !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			continue
+		}
+		tiff := segment[6:]
+		if len(tiff) < 8 {
+			return 1
+		}
+		var order binary.ByteOrder
+		switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 1
+		}
+
+		ifd := int(order.Uint32(tiff[4:]))
+		if ifd+2 > len(tiff) {
+			return 1
+		}
+		entries := int(order.Uint16(tiff[ifd:]))
+		for i := 0; i < entries; i++ {
+			entry := ifd + 2 + i*12
+			if entry+12 > len(tiff) {
+				return 1
+			}
+			if order.Uint16(tiff[entry:]) == tagOrientation {
+				return int(order.Uint16(tiff[entry+8:]))
+			}
+		}
+		return 1
+	}
+	return 1
+}
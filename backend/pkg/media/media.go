@@ -0,0 +1,368 @@
+// Package media checks uploaded images and videos and prepares the files
+// stored for them. Images are decoded and re-encoded, which drops EXIF, GPS
+// and any other embedded data, and get smaller variants for display. MP4
+// videos have their user data and metadata boxes blanked, WebM videos their
+// tags, attachments, title and recording date.
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+)
+
+const (
+	MaxPixels     = 40_000_000  // Larger images are refused before decoding
+	MaxGIFFrames  = 500         // Longer animations are refused before decoding
+	MaxGIFPixels  = 100_000_000 // Total pixels of all frames of an animation
+	MediumSize    = 1080        // Longest side of the medium variant
+	ThumbnailSize = 320         // Longest side of the thumbnail variant
+	jpegQuality   = 85
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported file type")
+	ErrPolyglot    = errors.New("file contains data besides the image or video")
+	ErrCorrupt     = errors.New("file is damaged")
+	ErrTooLarge    = fmt.Errorf("image has more than %d pixels", MaxPixels)
+	ErrTooLong     = fmt.Errorf("animation has more than %d frames or %d pixels in all", MaxGIFFrames, MaxGIFPixels)
+)
+
+// formats maps the sniffed content types accepted to their file extension
+var formats = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+// ContentType returns the content type of a stored file from its extension
+func ContentType(filename string) string {
+	for mimeType, ext := range formats {
+		if strings.HasSuffix(filename, ext) {
+			return mimeType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// File is one stored rendition of an upload
+type File struct {
+	Suffix   string // Added to the media ID to name the file: "" for the original
+	Ext      string
+	MimeType string
+	Data     []byte
+	Width    int // Images only
+	Height   int
+}
+
+// Upload is a checked upload ready to be stored
+type Upload struct {
+	Kind      string // "image" or "video"
+	SHA256    string // Of the original as stored
+	Original  File
+	Medium    *File // Nil when the original is small enough
+	Thumbnail *File
+}
+
+// Process checks the real type of data and prepares the files to store
+func Process(data []byte) (*Upload, error) {
+	mimeType := http.DetectContentType(data)
+	ext, ok := formats[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, mimeType)
+	}
+	if hasMarkup(data) {
+		return nil, ErrPolyglot
+	}
+
+	var upload *Upload
+	var err error
+	if strings.HasPrefix(mimeType, "video/") {
+		upload, err = processVideo(data, mimeType, ext)
+	} else {
+		upload, err = processImage(data, mimeType, ext)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(upload.Original.Data)
+	upload.SHA256 = hex.EncodeToString(sum[:])
+	return upload, nil
+}
+
+// markup is what a browser or interpreter could take a file for if it ignored
+// the content type it is served with
+var markup = [][]byte{
+	[]byte("<html"), []byte("<!doctype"), []byte("<script"), []byte("<svg"),
+	[]byte("<iframe"), []byte("<body"), []byte("<?php"), []byte("<?xml"),
+}
+
+// sniffWindow is how much of a file browsers look at to guess its type
+const sniffWindow = 1024
+
+// hasMarkup looks for markup where a browser would find it. Markup further in
+// is dropped with the rest of an image when it is re-encoded.
+func hasMarkup(data []byte) bool {
+	lower := bytes.ToLower(data[:min(len(data), sniffWindow)])
+	for _, m := range markup {
+		if bytes.Contains(lower, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func processVideo(data []byte, mimeType, ext string) (*Upload, error) {
+	switch mimeType {
+	case "video/mp4":
+		if !wholeMP4(data) {
+			return nil, ErrPolyglot
+		}
+		data = bytes.Clone(data)
+		stripMP4Metadata(data)
+	case "video/webm":
+		if !wholeWebM(data) {
+			return nil, ErrPolyglot
+		}
+		data = bytes.Clone(data)
+		stripWebMMetadata(data)
+	}
+	return &Upload{
+		Kind:     "video",
+		Original: File{Ext: ext, MimeType: mimeType, Data: data},
+	}, nil
+}
+
+// mp4Box returns the size of the box at the start of data and the size of its
+// header, or false if the box does not fit in data
+func mp4Box(data []byte) (size, header uint64, ok bool) {
+	if len(data) < 8 {
+		return 0, 0, false
+	}
+	size, header = uint64(binary.BigEndian.Uint32(data)), 8
+	switch size {
+	case 0: // Box extends to the end of the file
+		size = uint64(len(data))
+	case 1: // 64-bit size follows the type
+		if len(data) < 16 {
+			return 0, 0, false
+		}
+		size, header = binary.BigEndian.Uint64(data[8:]), 16
+	}
+	if size < header || size > uint64(len(data)) {
+		return 0, 0, false
+	}
+	return size, header, true
+}
+
+// wholeMP4 reports whether data is exactly a sequence of MP4 boxes, so
+// nothing is appended to or hidden between them
+func wholeMP4(data []byte) bool {
+	for len(data) > 0 {
+		size, _, ok := mp4Box(data)
+		if !ok {
+			return false
+		}
+		data = data[size:]
+	}
+	return true
+}
+
+var (
+	// mp4Containers are the boxes whose children may hold metadata
+	mp4Containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true}
+	// mp4Metadata are the boxes holding user data such as where a video was recorded
+	mp4Metadata = map[string]bool{"udta": true, "meta": true}
+)
+
+// stripMP4Metadata blanks every metadata box in data, turning it into a free
+// box of the same size so the offsets of the media samples stay valid
+func stripMP4Metadata(data []byte) {
+	for len(data) > 0 {
+		size, header, ok := mp4Box(data)
+		if !ok {
+			return
+		}
+		box := data[:size]
+		switch typ := string(box[4:8]); {
+		case mp4Metadata[typ]:
+			copy(box[4:8], "free")
+			clear(box[header:])
+		case mp4Containers[typ]:
+			stripMP4Metadata(box[header:])
+		}
+		data = data[size:]
+	}
+}
+
+// trailers are the bytes each image format must end with; anything after them
+// is data the decoder never looks at
+var trailers = map[string][]byte{
+	"image/jpeg": {0xff, 0xd9},
+	"image/png":  {0, 0, 0, 0, 'I', 'E', 'N', 'D', 0xae, 0x42, 0x60, 0x82},
+	"image/gif":  {0x3b},
+}
+
+func processImage(data []byte, mimeType, ext string) (*Upload, error) {
+	if !bytes.HasSuffix(data, trailers[mimeType]) {
+		return nil, ErrPolyglot
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != mimeType {
+		return nil, ErrCorrupt
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	var original []byte
+	var img *image.RGBA
+	switch mimeType {
+	case "image/gif":
+		// Keep the animation; variants show its first frame
+		frames, pixels, ok := gifFrames(data)
+		if !ok {
+			return nil, ErrCorrupt
+		}
+		if frames > MaxGIFFrames || pixels > MaxGIFPixels {
+			return nil, ErrTooLong
+		}
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(anim.Image) == 0 {
+			return nil, ErrCorrupt
+		}
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return nil, err
+		}
+		original = buf.Bytes()
+		img = toRGBA(anim.Image[0], image.Rect(0, 0, cfg.Width, cfg.Height))
+	default:
+		decoded, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrCorrupt
+		}
+		img = toRGBA(decoded, decoded.Bounds())
+		if mimeType == "image/jpeg" {
+			img = orient(img, exifOrientation(data))
+		}
+		if original, err = encode(img, mimeType); err != nil {
+			return nil, err
+		}
+	}
+
+	bounds := img.Bounds()
+	upload := &Upload{
+		Kind:     "image",
+		Original: File{Ext: ext, MimeType: mimeType, Data: original, Width: bounds.Dx(), Height: bounds.Dy()},
+	}
+
+	// Variants of GIFs are PNGs, since they are a single frame
+	variantType, variantExt := mimeType, ext
+	if mimeType == "image/gif" {
+		variantType, variantExt = "image/png", ".png"
+	}
+	for _, v := range []struct {
+		size   int
+		suffix string
+		dst    **File
+	}{
+		{MediumSize, "_medium", &upload.Medium},
+		{ThumbnailSize, "_thumb", &upload.Thumbnail},
+	} {
+		if max(bounds.Dx(), bounds.Dy()) <= v.size {
+			continue
+		}
+		scaled := resize(img, v.size)
+		data, err := encode(scaled, variantType)
+		if err != nil {
+			return nil, err
+		}
+		*v.dst = &File{
+			Suffix: v.suffix, Ext: variantExt, MimeType: variantType, Data: data,
+			Width: scaled.Bounds().Dx(), Height: scaled.Bounds().Dy(),
+		}
+	}
+	return upload, nil
+}
+
+// gifFrames walks the blocks of a GIF without decoding it and returns how many
+// frames it has and their total number of pixels
+func gifFrames(data []byte) (frames, pixels int, ok bool) {
+	// Header and logical screen descriptor, then the global color table
+	if len(data) < 13 {
+		return 0, 0, false
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (data[10]&0x07 + 1)
+	}
+
+	// skipSubBlocks moves past a sequence of data sub-blocks and its terminator
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			n := int(data[pos])
+			pos += 1 + n
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // Extension: label, then sub-blocks
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, 0, false
+			}
+		case 0x2c: // Image descriptor, local color table, LZW code size, sub-blocks
+			if pos+10 > len(data) {
+				return 0, 0, false
+			}
+			width := int(binary.LittleEndian.Uint16(data[pos+5:]))
+			height := int(binary.LittleEndian.Uint16(data[pos+7:]))
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 << (packed&0x07 + 1)
+			}
+			pos++
+			if !skipSubBlocks() {
+				return 0, 0, false
+			}
+			frames++
+			pixels += width * height
+		case 0x3b: // Trailer
+			return frames, pixels, true
+		default:
+			return 0, 0, false
+		}
+	}
+	return 0, 0, false
+}
+
+func encode(img image.Image, mimeType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if mimeType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
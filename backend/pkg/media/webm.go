@@ -0,0 +1,178 @@
+package media
+
+// WebM files are made of nested EBML elements, each an ID and a size written
+// as variable length integers followed by the element's data. These are the
+// IDs used here, with their length marker bits as they appear in the file.
+const (
+	webmEBML        = 0x1a45dfa3
+	webmSegment     = 0x18538067
+	webmInfo        = 0x1549a966
+	webmCluster     = 0x1f43b675
+	webmTags        = 0x1254c367
+	webmAttachments = 0x1941a469
+	webmTitle       = 0x7ba9
+	webmDateUTC     = 0x4461
+	webmVoid        = 0xec
+)
+
+var (
+	// webmSegmentChildren are the elements that end a Cluster of unknown size,
+	// which browsers record while they do not know how long it gets
+	webmSegmentChildren = map[uint32]bool{
+		0x114d9b74:      true, // SeekHead
+		webmInfo:        true,
+		0x1654ae6b:      true, // Tracks
+		webmCluster:     true,
+		0x1c53bb6b:      true, // Cues
+		webmAttachments: true,
+		0x1043a770:      true, // Chapters
+		webmTags:        true,
+	}
+	// webmMetadata are the Segment elements holding tags, such as where a video
+	// was recorded, and attached files
+	webmMetadata = map[uint32]bool{webmTags: true, webmAttachments: true}
+	// webmInfoMetadata are the Info elements naming and dating the recording
+	webmInfoMetadata = map[uint32]bool{webmTitle: true, webmDateUTC: true}
+)
+
+// webmVint reads the variable length integer at the start of data. id keeps
+// the length marker, as element IDs are written; otherwise it is removed and
+// unknown reports a size with every bit set.
+func webmVint(data []byte, maxLen int, id bool) (value uint64, n int, unknown, ok bool) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, false, false
+	}
+	for n = 1; data[0]&(0x80>>(n-1)) == 0; n++ {
+	}
+	if n > maxLen || n > len(data) {
+		return 0, 0, false, false
+	}
+	value = uint64(data[0])
+	if !id {
+		value &= 0xff >> n
+	}
+	for _, b := range data[1:n] {
+		value = value<<8 | uint64(b)
+	}
+	return value, n, !id && value == 1<<(7*n)-1, true
+}
+
+// webmElement returns the ID of the element at the start of data, the size of
+// its data, or -1 if unknown, and the size of its header, or false if the
+// element does not fit in data
+func webmElement(data []byte) (id uint32, size, header int, ok bool) {
+	rawID, idLen, _, ok := webmVint(data, 4, true)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	rawSize, sizeLen, unknown, ok := webmVint(data[idLen:], 8, false)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	header = idLen + sizeLen
+	if unknown {
+		return uint32(rawID), -1, header, true
+	}
+	if rawSize > uint64(len(data)-header) {
+		return 0, 0, 0, false
+	}
+	return uint32(rawID), int(rawSize), header, true
+}
+
+// webmElements calls fn with each element of data, and reports whether data is
+// exactly a sequence of elements, so nothing is appended to or hidden between
+// them. A Segment of unknown size lasts until the end of data; a Cluster of
+// unknown size until the next element of the Segment.
+func webmElements(data []byte, fn func(id uint32, element []byte, header int) bool) bool {
+	for len(data) > 0 {
+		id, size, header, ok := webmElement(data)
+		if !ok {
+			return false
+		}
+		if size < 0 {
+			switch id {
+			case webmSegment:
+				size = len(data) - header
+			case webmCluster:
+				if size, ok = webmClusterSize(data[header:]); !ok {
+					return false
+				}
+			default:
+				return false
+			}
+		}
+		if !fn(id, data[:header+size], header) {
+			return false
+		}
+		data = data[header+size:]
+	}
+	return true
+}
+
+// webmClusterSize returns how much of data belongs to a Cluster of unknown size
+func webmClusterSize(data []byte) (int, bool) {
+	n := 0
+	for n < len(data) {
+		id, size, header, ok := webmElement(data[n:])
+		if ok && webmSegmentChildren[id] {
+			break
+		}
+		if !ok || size < 0 {
+			return 0, false
+		}
+		n += header + size
+	}
+	return n, true
+}
+
+// wholeWebM reports whether data is an EBML header followed by Segments made
+// entirely of elements
+func wholeWebM(data []byte) bool {
+	if id, _, _, ok := webmElement(data); !ok || id != webmEBML {
+		return false
+	}
+	return webmElements(data, func(id uint32, element []byte, header int) bool {
+		if id != webmSegment {
+			return true
+		}
+		return webmElements(element[header:], func(uint32, []byte, int) bool { return true })
+	})
+}
+
+// stripWebMMetadata blanks the tags and attachments of every Segment in data
+// and the title and date of its Info, turning each into a Void element of the
+// same size so the positions recorded in the file stay valid
+func stripWebMMetadata(data []byte) {
+	webmElements(data, func(id uint32, segment []byte, header int) bool {
+		if id != webmSegment {
+			return true
+		}
+		return webmElements(segment[header:], func(id uint32, element []byte, header int) bool {
+			switch {
+			case webmMetadata[id]:
+				voidWebM(element)
+			case id == webmInfo:
+				webmElements(element[header:], func(id uint32, element []byte, _ int) bool {
+					if webmInfoMetadata[id] {
+						voidWebM(element)
+					}
+					return true
+				})
+			}
+			return true
+		})
+	})
+}
+
+// voidWebM overwrites element with a Void element of the same size
+func voidWebM(element []byte) {
+	sizeLen := min(8, len(element)-1)
+	size := uint64(len(element) - 1 - sizeLen)
+	clear(element)
+	element[0] = webmVoid
+	for i := sizeLen; i > 0; i-- {
+		element[i] = byte(size)
+		size >>= 8
+	}
+	element[1] |= 0x80 >> (sizeLen - 1)
+}
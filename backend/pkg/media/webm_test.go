@@ -0,0 +1,87 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// ebml builds an element with a one byte size, or an unknown size if body is nil
+func ebml(id []byte, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	size := byte(0xff)
+	if body != nil {
+		size = 0x80 | byte(len(data))
+	}
+	return append(append(append([]byte{}, id...), size), data...)
+}
+
+var (
+	idEBML        = []byte{0x1a, 0x45, 0xdf, 0xa3}
+	idDocType     = []byte{0x42, 0x82}
+	idSegment     = []byte{0x18, 0x53, 0x80, 0x67}
+	idInfo        = []byte{0x15, 0x49, 0xa9, 0x66}
+	idTimecode    = []byte{0x2a, 0xd7, 0xb1}
+	idTitle       = []byte{0x7b, 0xa9}
+	idDateUTC     = []byte{0x44, 0x61}
+	idTracks      = []byte{0x16, 0x54, 0xae, 0x6b}
+	idCluster     = []byte{0x1f, 0x43, 0xb6, 0x75}
+	idSimpleBlock = []byte{0xa3}
+	idTags        = []byte{0x12, 0x54, 0xc3, 0x67}
+	idTagString   = []byte{0x44, 0x87}
+)
+
+// webmFile returns a WebM whose Info holds a title and date and whose tags
+// record a location; unknown makes the Segment and Cluster of unknown size as
+// browsers record them
+func webmFile(unknown bool) []byte {
+	header := ebml(idEBML, ebml(idDocType, []byte("webm")))
+	info := ebml(idInfo, ebml(idTimecode, []byte{0x0f, 0x42, 0x40}), ebml(idTitle, []byte("Holiday")), ebml(idDateUTC, []byte("20260101")))
+	tracks := ebml(idTracks, []byte{0xae, 0x80})
+	block := ebml(idSimpleBlock, []byte("frame"))
+	tags := ebml(idTags, ebml(idTagString, []byte("+51.5074-000.1278/")))
+
+	if unknown {
+		return bytes.Join([][]byte{header, ebml(idSegment), info, tracks, ebml(idCluster), block, block, tags}, nil)
+	}
+	return bytes.Join([][]byte{header, ebml(idSegment, info, tracks, ebml(idCluster, block, block), tags)}, nil)
+}
+
+func TestProcessStripsWebMMetadata(t *testing.T) {
+	for _, unknown := range []bool{false, true} {
+		data := webmFile(unknown)
+		upload, err := Process(data)
+		if err != nil {
+			t.Fatalf("Process(unknown sizes %v) failed: %v", unknown, err)
+		}
+		got := upload.Original.Data
+		if upload.Original.MimeType != "video/webm" || len(got) != len(data) {
+			t.Fatalf("Process(unknown sizes %v) = %s of %d bytes, want video/webm of %d", unknown, upload.Original.MimeType, len(got), len(data))
+		}
+		for _, secret := range []string{"Holiday", "20260101", "+51.5074"} {
+			if bytes.Contains(got, []byte(secret)) {
+				t.Errorf("Process(unknown sizes %v) kept %q", unknown, secret)
+			}
+		}
+		for _, kept := range [][]byte{idTracks, []byte("frame"), {0x0f, 0x42, 0x40}} {
+			if !bytes.Contains(got, kept) {
+				t.Errorf("Process(unknown sizes %v) lost %x", unknown, kept)
+			}
+		}
+		if !wholeWebM(got) {
+			t.Errorf("Process(unknown sizes %v) left a file that does not parse", unknown)
+		}
+		if !bytes.Contains(data, []byte("Holiday")) {
+			t.Errorf("Process(unknown sizes %v) changed the uploaded bytes", unknown)
+		}
+	}
+}
+
+func TestProcessRejectsWebMWithTrailingData(t *testing.T) {
+	for _, unknown := range []bool{false, true} {
+		data := append(webmFile(unknown), []byte("PK\x03\x04hidden archive")...)
+		if _, err := Process(data); !errors.Is(err, ErrPolyglot) {
+			t.Errorf("Process(unknown sizes %v) = %v, want ErrPolyglot", unknown, err)
+		}
+	}
+}
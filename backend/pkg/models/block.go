@@ -0,0 +1,133 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Kinds of rows in the blocks table
+const (
+	BlockKindBlock = "block" // Both users are cut off from each other
+	BlockKindMute  = "mute"  // The muted user's posts are left out of the muter's feed
+)
+
+var (
+	ErrCannotBlockSelf = errors.New("cannot block or mute yourself")
+	ErrUserNotFound    = errors.New("user not found")
+)
+
+// AddBlock records that blockerID blocks or mutes blockedID; doing it twice is
+// not an error. Blocking also ends follows and pending follow requests and
+// invitations between the two users.
+func AddBlock(db *sql.DB, ctx context.Context, blockerID, blockedID, kind string) error {
+	if kind != BlockKindBlock && kind != BlockKindMute {
+		return fmt.Errorf("invalid block kind %q", kind)
+	}
+	if blockerID == blockedID {
+		return ErrCannotBlockSelf
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS(SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL)`, blockedID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to load user: %w", err)
+	}
+	if !exists {
+		return ErrUserNotFound
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO blocks (blocker_id, blocked_id, kind, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (blocker_id, blocked_id, kind) DO NOTHING`,
+		blockerID, blockedID, kind, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert block: %w", err)
+	}
+
+	if kind == BlockKindBlock {
+		pair := []interface{}{blockerID, blockedID}
+		cleanup := []struct {
+			stmt string
+			args []interface{}
+		}{
+			{`DELETE FROM follows
+			  WHERE (follower_id = ?1 AND followed_id = ?2) OR (follower_id = ?2 AND followed_id = ?1)`, pair},
+			{`DELETE FROM notifications
+			  WHERE type = 'follow_request'
+			    AND ((user_id = ?1 AND reference_id = ?2) OR (user_id = ?2 AND reference_id = ?1))`, pair},
+			{`UPDATE invitations SET deleted_at = ?3
+			  WHERE status = 'pending' AND deleted_at IS NULL
+			    AND ((inviter_id = ?1 AND invitee_id = ?2) OR (inviter_id = ?2 AND invitee_id = ?1))`, append(pair, now)},
+		}
+		for _, c := range cleanup {
+			if _, err := tx.ExecContext(ctx, c.stmt, c.args...); err != nil {
+				return fmt.Errorf("failed to end relationships: %w", err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RemoveBlock undoes AddBlock; removing a missing block is not an error.
+// Follows ended by the block are not restored.
+func RemoveBlock(db *sql.DB, ctx context.Context, blockerID, blockedID, kind string) error {
+	_, err := db.ExecContext(ctx,
+		`DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ? AND kind = ?`,
+		blockerID, blockedID, kind)
+	return err
+}
+
+// IsBlocked reports whether either user has blocked the other
+func IsBlocked(db *sql.DB, ctx context.Context, userID, otherID string) (bool, error) {
+	var isBlocked bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM blocks
+		              WHERE kind = 'block'
+		              AND ((blocker_id = ?1 AND blocked_id = ?2) OR (blocker_id = ?2 AND blocked_id = ?1)))`,
+		userID, otherID).Scan(&isBlocked)
+	return isBlocked, err
+}
+
+// GetBlockStatus reports whether userID has blocked or muted targetID. It
+// says nothing about whether targetID blocked userID.
+func GetBlockStatus(db *sql.DB, ctx context.Context, userID, targetID string) (blocked, muted bool, err error) {
+	err = db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM blocks WHERE blocker_id = ? AND blocked_id = ? AND kind = 'block'),
+		       EXISTS(SELECT 1 FROM blocks WHERE blocker_id = ? AND blocked_id = ? AND kind = 'mute')`,
+		userID, targetID, userID, targetID).Scan(&blocked, &muted)
+	return blocked, muted, err
+}
+
+// BlockedSQL returns an expression that is true when the user in column and
+// userID have blocked one another in either direction, along with its arguments
+func BlockedSQL(column, userID string) (string, []interface{}) {
+	return `EXISTS(SELECT 1 FROM blocks blk
+		WHERE blk.kind = 'block'
+		AND ((blk.blocker_id = ` + column + ` AND blk.blocked_id = ?)
+		  OR (blk.blocked_id = ` + column + ` AND blk.blocker_id = ?)))`,
+		[]interface{}{userID, userID}
+}
+
+// MutedSQL returns an expression that is true when userID muted the user in
+// column, along with its arguments
+func MutedSQL(column, userID string) (string, []interface{}) {
+	return `EXISTS(SELECT 1 FROM blocks mut
+		WHERE mut.kind = 'mute' AND mut.blocker_id = ? AND mut.blocked_id = ` + column + `)`,
+		[]interface{}{userID}
+}
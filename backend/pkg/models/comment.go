@@ -3,22 +3,176 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-// CreateComment creates a new comment on a post
-func CreateComment(db *sql.DB, ctx context.Context, postID, userID, content string, imageURL *string) (*Comment, error) {
+var (
+	ErrInvalidParentComment = errors.New("parent comment not found on this post")
+	ErrCommentNotFound      = errors.New("comment not found")
+	ErrCommentForbidden     = errors.New("not allowed to modify this comment")
+)
+
+// Limits for threaded comment trees
+const (
+	DefaultCommentDepth   = 3
+	MaxCommentDepth       = 10
+	DefaultRepliesPerNode = 3
+	MaxRepliesPerNode     = 50
+)
+
+// CommentTreeOptions controls how much of a comment thread is returned
+type CommentTreeOptions struct {
+	ParentID *string // nil for top-level comments, otherwise the comment whose replies are paged
+	Depth    int     // levels of replies nested under each returned comment; Comment.Depth counts from this level
+	Replies  int     // replies kept per comment below the first level
+	Offset   int     // paging of the first level
+	Limit    int     // 0 returns every first level comment
+}
+
+// GetCommentTree returns a post's comments nested by parent. The first level
+// (top-level comments, or the replies of opts.ParentID) is paged with Offset
+// and Limit; deeper levels keep at most Replies entries each, and every node
+// reports its full ReplyCount so clients can page the rest with ParentID.
+func GetCommentTree(db *sql.DB, ctx context.Context, postID, requestingUserID string, opts CommentTreeOptions) ([]Comment, int, error) {
+	if opts.Depth < 0 {
+		opts.Depth = 0
+	}
+	if opts.Depth > MaxCommentDepth {
+		opts.Depth = MaxCommentDepth
+	}
+	if opts.Replies <= 0 {
+		opts.Replies = DefaultRepliesPerNode
+	}
+	if opts.Replies > MaxRepliesPerNode {
+		opts.Replies = MaxRepliesPerNode
+	}
+
+	all, err := getPostComments(db, ctx, postID, requestingUserID, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	children := make(map[string][]Comment)
+	for _, c := range all {
+		parent := ""
+		if c.ParentCommentID != nil {
+			parent = *c.ParentCommentID
+		}
+		children[parent] = append(children[parent], c)
+	}
+
+	// Deleted comments only stay, as tombstones, while they still have live replies
+	var prune func(parent string) []Comment
+	prune = func(parent string) []Comment {
+		var kept []Comment
+		for _, c := range children[parent] {
+			replies := prune(c.ID)
+			if c.DeletedAt != nil {
+				if len(replies) == 0 {
+					continue
+				}
+				c = tombstone(c)
+			}
+			kept = append(kept, c)
+		}
+		children[parent] = kept
+		return kept
+	}
+	if opts.ParentID != nil {
+		prune(*opts.ParentID)
+	} else {
+		prune("")
+	}
+
+	var build func(parent string, depth int) []Comment
+	build = func(parent string, depth int) []Comment {
+		kids := children[parent]
+		if len(kids) > opts.Replies {
+			kids = kids[:opts.Replies]
+		}
+		nodes := make([]Comment, len(kids))
+		for i, c := range kids {
+			c.Depth = depth
+			c.ReplyCount = len(children[c.ID])
+			if depth < opts.Depth {
+				c.Replies = build(c.ID, depth+1)
+			}
+			nodes[i] = c
+		}
+		return nodes
+	}
+
+	root := ""
+	if opts.ParentID != nil {
+		root = *opts.ParentID
+	}
+
+	level := children[root]
+	total := len(level)
+	if opts.Offset > 0 {
+		if opts.Offset > len(level) {
+			opts.Offset = len(level)
+		}
+		level = level[opts.Offset:]
+	}
+	if opts.Limit > 0 && len(level) > opts.Limit {
+		level = level[:opts.Limit]
+	}
+
+	tree := make([]Comment, len(level))
+	for i, c := range level {
+		c.ReplyCount = len(children[c.ID])
+		if opts.Depth > 0 {
+			c.Replies = build(c.ID, 1)
+		}
+		tree[i] = c
+	}
+	return tree, total, nil
+}
+
+// tombstone strips a deleted comment down to what is needed to keep its thread in place
+func tombstone(c Comment) Comment {
+	return Comment{
+		ID:              c.ID,
+		PostID:          c.PostID,
+		ParentCommentID: c.ParentCommentID,
+		CreatedAt:       c.CreatedAt,
+		UpdatedAt:       c.UpdatedAt,
+		DeletedAt:       c.DeletedAt,
+		Deleted:         true,
+	}
+}
+
+// CreateComment creates a new comment on a post, or a reply when parentID is set
+func CreateComment(db *sql.DB, ctx context.Context, postID, userID, content string, imageURL, parentID *string) (*Comment, error) {
+	if parentID != nil {
+		// Replies must answer a live comment on the same post by someone not blocked
+		blocked, blockedArgs := BlockedSQL("comments.user_id", userID)
+		var parentPostID string
+		var isBlocked bool
+		err := db.QueryRowContext(ctx,
+			`SELECT post_id, `+blocked+` FROM comments WHERE id = ? AND deleted_at IS NULL`,
+			append(blockedArgs, *parentID)...).Scan(&parentPostID, &isBlocked)
+		if err == sql.ErrNoRows || (err == nil && (parentPostID != postID || isBlocked)) {
+			return nil, ErrInvalidParentComment
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	commentID := uuid.New().String()
 	now := time.Now().Unix()
 
 	stmt := `
-        INSERT INTO comments (id, post_id, user_id, content, image_url, created_at, updated_at)
-        VALUES (?, ?, ?, ?, ?, ?, ?)
+        INSERT INTO comments (id, post_id, parent_comment_id, user_id, content, image_url, created_at, updated_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
     `
 
-	_, err := db.ExecContext(ctx, stmt, commentID, postID, userID, content, imageURL, now, now)
+	_, err := db.ExecContext(ctx, stmt, commentID, postID, parentID, userID, content, imageURL, now, now)
 	if err != nil {
 		return nil, err
 	}
@@ -31,8 +185,8 @@ func CreateComment(db *sql.DB, ctx context.Context, postID, userID, content stri
 func GetCommentByID(db *sql.DB, ctx context.Context, commentID, requestingUserID string) (*Comment, error) {
 	stmt := `
         SELECT 
-            c.id, c.post_id, c.user_id, c.content, c.image_url, 
-            c.created_at, c.updated_at, c.deleted_at,
+            c.id, c.post_id, c.parent_comment_id, c.user_id, c.content, c.image_url, 
+            c.created_at, c.updated_at, c.edited_at, c.deleted_at,
             u.nickname, u.avatar_url,
             COUNT(l.id) as likes_count,
             EXISTS(
@@ -47,12 +201,12 @@ func GetCommentByID(db *sql.DB, ctx context.Context, commentID, requestingUserID
     `
 
 	var comment Comment
-	var imageURL sql.NullString
-	var deletedAt sql.NullInt64
+	var parentID, imageURL sql.NullString
+	var editedAt, deletedAt sql.NullInt64
 
 	err := db.QueryRowContext(ctx, stmt, requestingUserID, commentID).Scan(
-		&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &imageURL,
-		&comment.CreatedAt, &comment.UpdatedAt, &deletedAt,
+		&comment.ID, &comment.PostID, &parentID, &comment.UserID, &comment.Content, &imageURL,
+		&comment.CreatedAt, &comment.UpdatedAt, &editedAt, &deletedAt,
 		&comment.UserNickname, &comment.UserAvatar,
 		&comment.LikesCount, &comment.UserLiked,
 	)
@@ -61,10 +215,19 @@ func GetCommentByID(db *sql.DB, ctx context.Context, commentID, requestingUserID
 		return nil, err
 	}
 
+	if parentID.Valid {
+		comment.ParentCommentID = &parentID.String
+	}
+
 	if imageURL.Valid {
 		comment.ImageURL = &imageURL.String
 	}
 
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Int64
+		comment.Edited = true
+	}
+
 	if deletedAt.Valid {
 		comment.DeletedAt = &deletedAt.Int64
 	}
@@ -72,27 +235,38 @@ func GetCommentByID(db *sql.DB, ctx context.Context, commentID, requestingUserID
 	return &comment, nil
 }
 
-// GetPostComments retrieves all comments for a specific post
+// GetPostComments retrieves all comments for a specific post as a flat list, oldest first
 func GetPostComments(db *sql.DB, ctx context.Context, postID, requestingUserID string) ([]Comment, error) {
+	return getPostComments(db, ctx, postID, requestingUserID, false)
+}
+
+// getPostComments optionally includes soft-deleted comments so threads can keep
+// tombstones. Comments by users who blocked or were blocked by the requesting
+// user are left out, or turned into tombstones along with deleted ones.
+func getPostComments(db *sql.DB, ctx context.Context, postID, requestingUserID string, withDeleted bool) ([]Comment, error) {
+	blocked, blockedArgs := BlockedSQL("c.user_id", requestingUserID)
 	stmt := `
         SELECT 
-            c.id, c.post_id, c.user_id, c.content, c.image_url, 
-            c.created_at, c.updated_at, c.deleted_at,
+            c.id, c.post_id, c.parent_comment_id, c.user_id, c.content, c.image_url, 
+            c.created_at, c.updated_at, c.edited_at, c.deleted_at,
             u.nickname, u.avatar_url,
             COUNT(l.id) as likes_count,
             EXISTS(
                 SELECT 1 FROM likes 
                 WHERE user_id = ? AND likeable_type = 'comment' AND likeable_id = c.id AND deleted_at IS NULL
-            ) as user_liked
+            ) as user_liked,
+            ` + blocked + ` as blocked
         FROM comments c
         JOIN users u ON c.user_id = u.id
         LEFT JOIN likes l ON l.likeable_id = c.id AND l.likeable_type = 'comment' AND l.deleted_at IS NULL
-        WHERE c.post_id = ? AND c.deleted_at IS NULL
+        WHERE c.post_id = ? AND (c.deleted_at IS NULL OR ?)
         GROUP BY c.id
-        ORDER BY c.created_at ASC
+        ORDER BY c.created_at ASC, c.rowid ASC
     `
 
-	rows, err := db.QueryContext(ctx, stmt, requestingUserID, postID)
+	args := append([]interface{}{requestingUserID}, blockedArgs...)
+	args = append(args, postID, withDeleted)
+	rows, err := db.QueryContext(ctx, stmt, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -101,24 +275,41 @@ func GetPostComments(db *sql.DB, ctx context.Context, postID, requestingUserID s
 	var comments []Comment
 	for rows.Next() {
 		var comment Comment
-		var imageURL sql.NullString
-		var deletedAt sql.NullInt64
+		var parentID, imageURL sql.NullString
+		var editedAt, deletedAt sql.NullInt64
+		var isBlocked bool
 
 		err := rows.Scan(
-			&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &imageURL,
-			&comment.CreatedAt, &comment.UpdatedAt, &deletedAt,
+			&comment.ID, &comment.PostID, &parentID, &comment.UserID, &comment.Content, &imageURL,
+			&comment.CreatedAt, &comment.UpdatedAt, &editedAt, &deletedAt,
 			&comment.UserNickname, &comment.UserAvatar,
-			&comment.LikesCount, &comment.UserLiked,
+			&comment.LikesCount, &comment.UserLiked, &isBlocked,
 		)
 
 		if err != nil {
 			return nil, err
 		}
+		if isBlocked {
+			if !withDeleted {
+				continue
+			}
+			// Shown like a deleted comment so replies by others keep their place
+			deletedAt = sql.NullInt64{Int64: comment.UpdatedAt, Valid: true}
+		}
+
+		if parentID.Valid {
+			comment.ParentCommentID = &parentID.String
+		}
 
 		if imageURL.Valid {
 			comment.ImageURL = &imageURL.String
 		}
 
+		if editedAt.Valid {
+			comment.EditedAt = &editedAt.Int64
+			comment.Edited = true
+		}
+
 		if deletedAt.Valid {
 			comment.DeletedAt = &deletedAt.Int64
 		}
@@ -130,13 +321,17 @@ func GetPostComments(db *sql.DB, ctx context.Context, postID, requestingUserID s
 		return []Comment{}, nil
 	}
 
+	if err := attachCommentReactions(db, ctx, requestingUserID, comments); err != nil {
+		return nil, err
+	}
+
 	return comments, nil
 }
 
 // GetCommentLikes retrieves all likes for a specific comment
 func GetCommentLikes(db *sql.DB, ctx context.Context, commentID string) ([]Like, error) {
 	stmt := `
-		SELECT id, user_id, likeable_id, created_at 
+		SELECT id, user_id, likeable_id, reaction, created_at 
 		FROM likes 
 		WHERE likeable_type = 'comment' AND likeable_id = ? AND deleted_at IS NULL
 		ORDER BY created_at DESC
@@ -153,7 +348,7 @@ func GetCommentLikes(db *sql.DB, ctx context.Context, commentID string) ([]Like,
 		var like Like
 		like.LikeableType = "comment"
 
-		err := rows.Scan(&like.ID, &like.UserID, &like.LikeableID, &like.CreatedAt)
+		err := rows.Scan(&like.ID, &like.UserID, &like.LikeableID, &like.Reaction, &like.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -189,3 +384,57 @@ func HasUserLikedComment(db *sql.DB, ctx context.Context, userID, commentID stri
 
 	return true, nil
 }
+
+// UpdateComment lets the author change a comment's content and image
+func UpdateComment(db *sql.DB, ctx context.Context, commentID, userID, content string, imageURL *string) (*Comment, error) {
+	var authorID string
+	err := db.QueryRowContext(ctx,
+		`SELECT user_id FROM comments WHERE id = ? AND deleted_at IS NULL`, commentID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if authorID != userID {
+		return nil, ErrCommentForbidden
+	}
+
+	now := time.Now().Unix()
+	_, err = db.ExecContext(ctx, `
+		UPDATE comments SET content = ?, image_url = ?, updated_at = ?, edited_at = ?
+		WHERE id = ?`, content, imageURL, now, now, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return GetCommentByID(db, ctx, commentID, userID)
+}
+
+// DeleteComment soft deletes a comment. The comment author, the post author
+// and, for group posts, the group admins may delete it.
+func DeleteComment(db *sql.DB, ctx context.Context, commentID, userID string) error {
+	var allowed bool
+	err := db.QueryRowContext(ctx, `
+		SELECT c.user_id = ? OR p.user_id = ? OR EXISTS(
+			SELECT 1 FROM group_members gm
+			WHERE gm.group_id = p.group_id AND gm.user_id = ?
+			AND gm.role = 'admin' AND gm.deleted_at IS NULL
+		)
+		FROM comments c
+		JOIN posts p ON c.post_id = p.id
+		WHERE c.id = ? AND c.deleted_at IS NULL`,
+		userID, userID, userID, commentID).Scan(&allowed)
+	if err == sql.ErrNoRows {
+		return ErrCommentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrCommentForbidden
+	}
+
+	_, err = db.ExecContext(ctx, `UPDATE comments SET deleted_at = ? WHERE id = ?`, time.Now().Unix(), commentID)
+	return err
+}
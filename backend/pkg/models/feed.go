@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultFeedLimit = 20
+	MaxFeedLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedCursor marks the last post of a feed page; pages are ordered by
+// created_at then id, both descending, so ties on created_at stay stable
+type FeedCursor struct {
+	CreatedAt int64
+	ID        string
+}
+
+// Encode returns the opaque form handed to clients
+func (c FeedCursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt, 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeFeedCursor parses a cursor produced by FeedCursor.Encode
+func DecodeFeedCursor(s string) (*FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+	ts, err := strconv.ParseInt(createdAt, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &FeedCursor{CreatedAt: ts, ID: id}, nil
+}
+
+// GetFeed returns the viewer's home feed: their own posts, posts from users
+// they follow, and posts from their groups, filtered by PostVisibleSQL and
+// leaving out users they muted.
+// It returns the cursor for the next page, or nil when there are no more posts.
+func GetFeed(db *sql.DB, ctx context.Context, viewerID string, cursor *FeedCursor, limit int) ([]Post, *FeedCursor, error) {
+	if limit <= 0 {
+		limit = DefaultFeedLimit
+	}
+	if limit > MaxFeedLimit {
+		limit = MaxFeedLimit
+	}
+
+	visible, visibleArgs := PostVisibleSQL("p", viewerID)
+	muted, mutedArgs := MutedSQL("p.user_id", viewerID)
+
+	// A post is in the feed if the viewer may see it and it is their own,
+	// from someone they follow, or from one of their groups, unless the viewer
+	// muted its author
+	query := `
+		SELECT p.id, p.user_id, p.group_id, p.content, p.privacy, p.image_url,
+		       p.created_at, p.updated_at, p.edited_at,
+		       (SELECT COUNT(*) FROM likes
+		        WHERE likeable_type = 'post' AND likeable_id = p.id AND deleted_at IS NULL) AS likes_count,
+		       EXISTS(SELECT 1 FROM likes
+		              WHERE likeable_type = 'post' AND likeable_id = p.id
+		              AND user_id = ? AND deleted_at IS NULL) AS user_liked
+		FROM posts p
+		WHERE ` + visible + `
+		  AND NOT ` + muted + `
+		  AND (
+		       p.user_id = ?
+		       OR (p.group_id IS NULL AND EXISTS(
+		             SELECT 1 FROM follows f
+		             WHERE f.follower_id = ? AND f.followed_id = p.user_id
+		             AND f.status = 'accepted' AND f.deleted_at IS NULL
+		           ))
+		       OR p.group_id IS NOT NULL
+		  )`
+	args := []interface{}{viewerID}
+	args = append(args, visibleArgs...)
+	args = append(args, mutedArgs...)
+	args = append(args, viewerID, viewerID)
+
+	if cursor != nil {
+		query += `
+		  AND (p.created_at < ? OR (p.created_at = ? AND p.id < ?))`
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	// Fetch one extra row to know whether another page exists
+	query += `
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT ?`
+	args = append(args, limit+1)
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("database query error: %w", err)
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		var groupID, imageURL sql.NullString
+		var editedAt sql.NullInt64
+		err := rows.Scan(&post.ID, &post.UserID, &groupID, &post.Content, &post.Privacy, &imageURL,
+			&post.CreatedAt, &post.UpdatedAt, &editedAt, &post.LikesCount, &post.UserLiked)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error scanning post: %w", err)
+		}
+		if groupID.Valid {
+			post.GroupID = &groupID.String
+		}
+		if imageURL.Valid {
+			post.ImageURL = &imageURL.String
+		}
+		if editedAt.Valid {
+			post.EditedAt = &editedAt.Int64
+			post.Edited = true
+		}
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *FeedCursor
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[len(posts)-1]
+		next = &FeedCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	if err := AttachPostReactions(db, ctx, viewerID, posts); err != nil {
+		return nil, nil, fmt.Errorf("error loading reactions: %w", err)
+	}
+	if err := AttachPostMedia(db, ctx, posts); err != nil {
+		return nil, nil, fmt.Errorf("error loading media: %w", err)
+	}
+
+	return posts, next, nil
+}
@@ -4,146 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"log"
 	"time"
-
-	"github.com/google/uuid"
 )
 
+// ErrLikeNotFound is returned when removing a reaction the user has not left
+var ErrLikeNotFound = errors.New("like not found or already removed")
+
 // NotificationSender interface to avoid import cycles
 type NotificationSender interface {
 	SendNotification(userID string, notification Notification, metadata map[string]interface{})
 }
 
+// CreateLike adds a "like" reaction; see React for other reactions
 func CreateLike(db *sql.DB, ctx context.Context, notificationModel *NotificationModel, hub NotificationSender, userID, likeableType, likeableID string) (*Like, error) {
-	if likeableType != "post" && likeableType != "comment" {
-		return nil, errors.New("invalid likeable type")
-	}
-	// Check if the user already liked this content
-	var existingID string
-	var deletedAt *int64
-	checkStmt := `
-		SELECT id, deleted_at FROM likes 
-		WHERE user_id = ? AND likeable_type = ? AND likeable_id = ?
-	`
-	err := db.QueryRowContext(ctx, checkStmt, userID, likeableType, likeableID).Scan(&existingID, &deletedAt)
-
-	now := time.Now().Unix()
-	// If like exists but was deleted, reactivate it
-	if err == nil && deletedAt != nil {
-		// Reactivate the like by setting deleted_at to NULL
-		updateStmt := `UPDATE likes SET deleted_at = NULL WHERE id = ?`
-		_, err := db.ExecContext(ctx, updateStmt, existingID)
-		if err != nil {
-			return nil, err
-		}
-		return &Like{
-			ID:           existingID,
-			UserID:       userID,
-			LikeableType: likeableType,
-			LikeableID:   likeableID,
-			CreatedAt:    now,
-			DeletedAt:    nil,
-		}, nil
-	} else if err == nil {
-		// Like already exists and is active
-		return nil, errors.New("user already liked this content")
-	} else if err != sql.ErrNoRows {
-		// Some other database error
-		return nil, err
-	}
-	// Create new like
-	id := uuid.New().String()
-	insertStmt := `
-		INSERT INTO likes (id, user_id, likeable_type, likeable_id, created_at) 
-		VALUES (?, ?, ?, ?, ?)
-	`
-
-	_, err = db.ExecContext(ctx, insertStmt, id, userID, likeableType, likeableID, now)
-	if err != nil {
-		return nil, err
-	}
-	// Create notification for the content owner if it's a post like
-	if likeableType == "post" {
-		// Get post owner
-		var postOwnerID string
-		postOwnerStmt := `SELECT user_id FROM posts WHERE id = ?`
-		err = db.QueryRowContext(ctx, postOwnerStmt, likeableID).Scan(&postOwnerID)
-		if err == nil && postOwnerID != userID {
-			log.Printf("DEBUG: Creating like notification - PostOwner: %s, Liker: %s, PostID: %s", postOwnerID, userID, likeableID)
-			notification := Notification{
-				ID:          uuid.New().String(),
-				UserID:      postOwnerID,
-				Type:        "new_like",
-				ReferenceID: likeableID,
-				IsRead:      false,
-				CreatedAt:   time.Now(),
-			}
-			_, err = notificationModel.Insert(ctx, notification)
-			if err != nil {
-				log.Printf("ERROR: Failed to create notification for like: %v", err)
-			} else {
-				log.Printf("SUCCESS: Like notification created for post owner: %s", postOwnerID)
-
-				// Send real-time notification if hub is available
-				if hub != nil {
-					// Get liker info
-					var likerNickname, likerAvatar string
-					db.QueryRowContext(ctx, "SELECT nickname, avatar_url FROM users WHERE id = ?", userID).Scan(&likerNickname, &likerAvatar)
-
-					hub.SendNotification(postOwnerID, notification, map[string]interface{}{
-						"post_id":        likeableID,
-						"liker_id":       userID,
-						"actor_nickname": likerNickname,
-						"actor_avatar":   likerAvatar,
-					})
-				}
-			}
-		} else if err != nil {
-			log.Printf("ERROR: Failed to get post owner for like notification: %v", err)
-		} else {
-			log.Printf("DEBUG: Not creating like notification - self-like detected")
-		}
-	}
-
-	// Create notification for comment likes
-	if likeableType == "comment" {
-		// Get comment owner and post ID
-		var commentOwnerID, postID string
-		commentOwnerStmt := `SELECT user_id, post_id FROM comments WHERE id = ?`
-		err = db.QueryRowContext(ctx, commentOwnerStmt, likeableID).Scan(&commentOwnerID, &postID)
-		if err == nil && commentOwnerID != userID {
-			// Don't notify for self-likes
-			notification := Notification{
-				ID:          uuid.New().String(),
-				UserID:      commentOwnerID,
-				Type:        "new_like",
-				ReferenceID: postID,  // Use post ID for navigation
-				ActorID:     &userID, // Store who performed the action
-				IsRead:      false,
-				CreatedAt:   time.Now(),
-			}
-			_, err = notificationModel.Insert(ctx, notification)
-			if err != nil {
-				fmt.Printf("Failed to create notification for comment like: %v\n", err)
-			} else {
-				log.Printf("SUCCESS: Comment like notification created for comment owner: %s", commentOwnerID)
-			}
-		}
-	}
-
-	return &Like{
-		ID:           id,
-		UserID:       userID,
-		LikeableType: likeableType,
-		LikeableID:   likeableID,
-		CreatedAt:    now,
-		DeletedAt:    nil,
-	}, nil
+	return React(db, ctx, notificationModel, hub, userID, likeableType, likeableID, "like")
 }
 
-// UnlikeContent removes a like from a post or comment
+// UnlikeContent removes the user's reaction from a post or comment
 func UnlikeContent(db *sql.DB, ctx context.Context, userID, likeableType, likeableID string) error {
 	if likeableType != "post" && likeableType != "comment" {
 		return errors.New("invalid likeable type")
@@ -165,7 +42,7 @@ func UnlikeContent(db *sql.DB, ctx context.Context, userID, likeableType, likeab
 
 	rowsAffected, _ := result.RowsAffected()
 	if rowsAffected == 0 {
-		return errors.New("like not found or already removed")
+		return ErrLikeNotFound
 	}
 
 	return nil
@@ -174,7 +51,7 @@ func UnlikeContent(db *sql.DB, ctx context.Context, userID, likeableType, likeab
 // GetPostLikes retrieves all likes for a specific post
 func GetPostLikes(db *sql.DB, ctx context.Context, postID string) ([]Like, error) {
 	stmt := `
-		  SELECT id, user_id, likeable_id, created_at 
+		  SELECT id, user_id, likeable_id, reaction, created_at 
         FROM likes 
         WHERE likeable_type = 'post' AND likeable_id = ? AND deleted_at IS NULL
         ORDER BY created_at DESC
@@ -191,7 +68,7 @@ func GetPostLikes(db *sql.DB, ctx context.Context, postID string) ([]Like, error
 		var like Like
 		like.LikeableType = "post"
 
-		err := rows.Scan(&like.ID, &like.UserID, &like.LikeableID, &like.CreatedAt)
+		err := rows.Scan(&like.ID, &like.UserID, &like.LikeableID, &like.Reaction, &like.CreatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+)
+
+// UploadsPrefix is the URL path under which media files are served
+const UploadsPrefix = "/uploads/"
+
+// Media is a file uploaded through /api/upload
+type Media struct {
+	ID                string  `json:"id"`
+	OwnerID           string  `json:"owner_id"`
+	Kind              string  `json:"kind"` // "image" or "video"
+	MimeType          string  `json:"mime_type"`
+	Size              int64   `json:"size"`
+	Width             *int    `json:"width,omitempty"`
+	Height            *int    `json:"height,omitempty"`
+	SHA256            string  `json:"sha256"`
+	Filename          string  `json:"-"`
+	MediumFilename    *string `json:"-"`
+	ThumbnailFilename *string `json:"-"`
+	URL               string  `json:"url"`
+	MediumURL         string  `json:"medium_url"`    // The original when it is small enough
+	ThumbnailURL      string  `json:"thumbnail_url"` // Likewise
+	CreatedAt         int64   `json:"created_at"`
+}
+
+// Files lists the stored file names of the media, original first
+func (m *Media) Files() []string {
+	files := []string{m.Filename}
+	for _, variant := range []*string{m.MediumFilename, m.ThumbnailFilename} {
+		if variant != nil {
+			files = append(files, *variant)
+		}
+	}
+	return files
+}
+
+// setURLs fills in the URLs from the file names
+func (m *Media) setURLs() {
+	m.URL = UploadsPrefix + m.Filename
+	m.MediumURL, m.ThumbnailURL = m.URL, m.URL
+	if m.MediumFilename != nil {
+		m.MediumURL = UploadsPrefix + *m.MediumFilename
+	}
+	if m.ThumbnailFilename != nil {
+		m.ThumbnailURL = UploadsPrefix + *m.ThumbnailFilename
+	}
+}
+
+// InsertMedia records an uploaded file whose files have been stored
+func InsertMedia(db *sql.DB, ctx context.Context, m *Media) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO media (id, owner_id, kind, mime_type, size, width, height, sha256,
+		                   filename, medium_filename, thumbnail_filename, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ID, m.OwnerID, m.Kind, m.MimeType, m.Size, m.Width, m.Height, m.SHA256,
+		m.Filename, m.MediumFilename, m.ThumbnailFilename, m.CreatedAt)
+	if err != nil {
+		return err
+	}
+	m.setURLs()
+	return nil
+}
+
+// GetMediaByFile returns the media stored under filename, which may be the
+// original or one of its variants. It returns sql.ErrNoRows for files uploaded
+// before media were recorded.
+func GetMediaByFile(db *sql.DB, ctx context.Context, filename string) (*Media, error) {
+	var m Media
+	err := db.QueryRowContext(ctx, `
+		SELECT id, owner_id, kind, mime_type, size, width, height, sha256,
+		       filename, medium_filename, thumbnail_filename, created_at
+		FROM media
+		WHERE filename = ? OR medium_filename = ? OR thumbnail_filename = ?`,
+		filename, filename, filename).Scan(
+		&m.ID, &m.OwnerID, &m.Kind, &m.MimeType, &m.Size, &m.Width, &m.Height, &m.SHA256,
+		&m.Filename, &m.MediumFilename, &m.ThumbnailFilename, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	m.setURLs()
+	return &m, nil
+}
+
+// DeleteMedia forgets the media stored under filename and returns the files to
+// remove: the original and its variants, or just filename if it predates media
+func DeleteMedia(db *sql.DB, ctx context.Context, filename string) ([]string, error) {
+	m, err := GetMediaByFile(db, ctx, filename)
+	if err == sql.ErrNoRows {
+		return []string{filename}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM media WHERE id = ?`, m.ID); err != nil {
+		return nil, err
+	}
+	return m.Files(), nil
+}
@@ -33,14 +33,37 @@ type Post struct {
 	GroupID   *string `json:"group_id"` // Nullable
 	Content   string  `json:"content"`
 	Privacy   string  `json:"privacy"`
+	ImageURL  *string `json:"image_url,omitempty"`
 	CreatedAt int64   `json:"created_at"`
 
 	UpdatedAt  int64  `json:"updated_at"`
 	DeletedAt  *int64 `json:"deleted_at"` // Nullable
+	EditedAt   *int64 `json:"edited_at,omitempty"`
+	Edited     bool   `json:"edited"`
 	LikesCount int    `json:"likes_count"`
 	UserLiked  bool   `json:"user_liked,omitempty"`
 
+	// Reactions: count per reaction (LikesCount is their total) and the viewer's own
+	ReactionCounts map[string]int `json:"reaction_counts,omitempty"`
+	UserReaction   *string        `json:"user_reaction,omitempty"`
+
 	AllowedUserIDs []string `json:"allowed_user_ids,omitempty"`
+
+	// Media is the post's gallery in display order
+	Media []PostMedia `json:"media"`
+}
+
+// PostRevision is a previous version of an edited post
+type PostRevision struct {
+	ID        string  `json:"id"`
+	PostID    string  `json:"post_id"`
+	EditorID  string  `json:"editor_id"`
+	Content   string  `json:"content"`
+	ImageURL  *string `json:"image_url,omitempty"`
+	Privacy   string  `json:"privacy"`
+	CreatedAt int64   `json:"created_at"`
+
+	Media []PostMedia `json:"media"`
 }
 
 // Like represents a like on a post or comment
@@ -49,6 +72,7 @@ type Like struct {
 	UserID       string `json:"user_id"`
 	LikeableType string `json:"likeable_type"` // "post" or "comment"
 	LikeableID   string `json:"likeable_id"`
+	Reaction     string `json:"reaction"`
 	CreatedAt    int64  `json:"created_at"`
 	DeletedAt    *int64 `json:"deleted_at,omitempty"`
 }
@@ -114,32 +138,46 @@ type EventAttendee struct {
 
 // Comment represents a comment on a post
 type Comment struct {
-	ID        string  `json:"id"`
-	PostID    string  `json:"post_id"`
-	UserID    string  `json:"user_id"`
-	Content   string  `json:"content"`
-	ImageURL  *string `json:"image_url,omitempty"`
-	CreatedAt int64   `json:"created_at"`
-	UpdatedAt int64   `json:"updated_at"`
-	DeletedAt *int64  `json:"deleted_at,omitempty"`
+	ID              string  `json:"id"`
+	PostID          string  `json:"post_id"`
+	ParentCommentID *string `json:"parent_comment_id"` // Nullable, set on replies
+	UserID          string  `json:"user_id"`
+	Content         string  `json:"content"`
+	ImageURL        *string `json:"image_url,omitempty"`
+	CreatedAt       int64   `json:"created_at"`
+	UpdatedAt       int64   `json:"updated_at"`
+	EditedAt        *int64  `json:"edited_at,omitempty"`
+	DeletedAt       *int64  `json:"deleted_at,omitempty"`
+	Edited          bool    `json:"edited"`
+	Deleted         bool    `json:"deleted,omitempty"` // Tombstone kept because it has replies
 
 	// Additional fields for API responses
 	UserNickname string `json:"user_nickname,omitempty"`
 	UserAvatar   string `json:"user_avatar,omitempty"`
 	LikesCount   int    `json:"likes_count"`
 	UserLiked    bool   `json:"user_liked,omitempty"`
+
+	ReactionCounts map[string]int `json:"reaction_counts,omitempty"`
+	UserReaction   *string        `json:"user_reaction,omitempty"`
+
+	// Threading: direct replies (limited per request) and how many exist in total
+	Replies    []Comment `json:"replies,omitempty"`
+	ReplyCount int       `json:"reply_count"`
+	Depth      int       `json:"depth"`
 }
 
 // Notification represents a notification in the system.
 type Notification struct {
-	ID          string     `json:"id"`
-	UserID      string     `json:"user_id"`
-	Type        string     `json:"type"`
-	ReferenceID string     `json:"reference_id"`
-	ActorID     *string    `json:"actor_id,omitempty"`
-	IsRead      bool       `json:"is_read"`
-	CreatedAt   time.Time  `json:"created_at"`
-	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+	ID           string     `json:"id"`
+	UserID       string     `json:"user_id"`
+	Type         string     `json:"type"`
+	ReferenceID  string     `json:"reference_id"`
+	ActorID      *string    `json:"actor_id,omitempty"`
+	Reaction     *string    `json:"reaction,omitempty"`      // Set on new_like notifications
+	LikeableType *string    `json:"likeable_type,omitempty"` // "post" or "comment", set on new_like notifications
+	IsRead       bool       `json:"is_read"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
 }
 	
 type Chat struct {
@@ -150,13 +188,53 @@ type Chat struct {
 }
 
 type Message struct {
-	ID       string `json:"id"`
-	ChatID   string `json:"chat_id"`
-	SenderID string `json:"sender_id"`
-	Sender   User   `json:"sender,omitempty"`
-	Content  string `json:"content"`
-	SentAt   int64  `json:"sent_at"`
-	ReadAt   *int64 `json:"read_at,omitempty"`
+	ID       string   `json:"id"`
+	ChatID   string   `json:"chat_id"`
+	SenderID string   `json:"sender_id"`
+	Sender   User     `json:"sender,omitempty"`
+	Content  string   `json:"content"`
+	SentAt   int64    `json:"sent_at"`
+	ReadAt   *int64   `json:"read_at,omitempty"`
+	ReadBy   []string `json:"read_by,omitempty"` // Other participants who have read up to this message
+	EditedAt *int64   `json:"edited_at,omitempty"`
+	Edited   bool     `json:"edited"`
+
+	// Reactions maps each reaction to the users who chose it
+	Reactions map[string][]string `json:"reactions,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Attachment is a file uploaded to a chat and sent with a message
+type Attachment struct {
+	ID          string  `json:"id"`
+	ChatID      string  `json:"chat_id"`
+	MessageID   *string `json:"message_id"` // Nil until sent
+	UploaderID  string  `json:"uploader_id"`
+	URL         string  `json:"url"` // Download URL, participants only
+	StoragePath string  `json:"-"`
+	Filename    string  `json:"filename"`
+	MimeType    string  `json:"mime_type"`
+	Size        int64   `json:"size"`
+	Width       *int    `json:"width,omitempty"`
+	Height      *int    `json:"height,omitempty"`
+	CreatedAt   int64   `json:"created_at"`
+}
+
+// MessageRevision is a previous content of an edited message
+type MessageRevision struct {
+	ID        string `json:"id"`
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// ReadReceipt records how far a participant has read a chat
+type ReadReceipt struct {
+	ChatID    string `json:"chat_id"`
+	UserID    string `json:"user_id"`
+	MessageID string `json:"message_id"`
+	ReadAt    int64  `json:"read_at"`
 }
 
 type ChatParticipant struct {
@@ -166,3 +244,16 @@ type ChatParticipant struct {
 	JoinedAt  int64  `json:"joined_at"`
 	DeletedAt *int64 `json:"deleted_at,omitempty"`
 }
+
+// Session represents a login session persisted server-side
+type Session struct {
+	ID         string `json:"id"`
+	UserID     string `json:"user_id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	RevokedAt  *int64 `json:"revoked_at,omitempty"`
+	Current    bool   `json:"current"`
+}
@@ -17,8 +17,8 @@ type NotificationModel struct {
 
 func (nm *NotificationModel) Insert(ctx context.Context, notification Notification) (*Notification, error) {
 	query := `
-		INSERT INTO notifications (id, user_id, type, reference_id, actor_id, is_read, created_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO notifications (id, user_id, type, reference_id, actor_id, reaction, likeable_type, is_read, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := nm.DB.ExecContext(ctx, query,
@@ -27,6 +27,8 @@ func (nm *NotificationModel) Insert(ctx context.Context, notification Notificati
 		notification.Type,
 		notification.ReferenceID,
 		notification.ActorID,
+		notification.Reaction,
+		notification.LikeableType,
 		notification.IsRead,
 		notification.CreatedAt.Unix(),
 	)
@@ -50,6 +52,8 @@ func (nm *NotificationModel) GetByUserID(ctx context.Context, userID string) ([]
 			n.type,
 			n.reference_id,
 			COALESCE(n.actor_id, '') as actor_id,
+			COALESCE(n.reaction, '') as reaction,
+			COALESCE(n.likeable_type, 'post') as likeable_type,
 			n.is_read,
 			n.created_at,
 			COALESCE(u.nickname, '') as actor_nickname,
@@ -73,12 +77,12 @@ func (nm *NotificationModel) GetByUserID(ctx context.Context, userID string) ([]
 	var notifications []map[string]interface{}
 
 	for rows.Next() {
-		var id, notifUserID, notifType, referenceID, actorID string
+		var id, notifUserID, notifType, referenceID, actorID, reaction, likeableType string
 		var actorNickname, actorAvatar string
 		var isRead bool
 		var createdAt int64
 		
-		err := rows.Scan(&id, &notifUserID, &notifType, &referenceID, &actorID, &isRead, &createdAt, &actorNickname, &actorAvatar)
+		err := rows.Scan(&id, &notifUserID, &notifType, &referenceID, &actorID, &reaction, &likeableType, &isRead, &createdAt, &actorNickname, &actorAvatar)
 		if err != nil {
 			log.Printf("ERROR: Failed to scan notification: %v", err)
 			continue
@@ -87,6 +91,9 @@ func (nm *NotificationModel) GetByUserID(ctx context.Context, userID string) ([]
 		log.Printf("DEBUG: Processing notification - ID: %s, Type: %s, ActorID: %s", id, notifType, actorID)
 		
 		message, link := nm.formatNotificationMessage(notifType, referenceID)
+		if notifType == "new_like" {
+			message = reactionMessage(reaction, likeableType)
+		}
 		
 		notification := map[string]interface{}{
 			"id":           id,
@@ -97,6 +104,12 @@ func (nm *NotificationModel) GetByUserID(ctx context.Context, userID string) ([]
 			"created_at":   createdAt,
 			"reference_id": referenceID,
 		}
+		if reaction != "" {
+			notification["reaction"] = reaction
+		}
+		if notifType == "new_like" {
+			notification["likeable_type"] = likeableType
+		}
 		
 		if actorNickname != "" {
 			notification["actor_nickname"] = actorNickname
@@ -124,6 +137,8 @@ func (nm *NotificationModel) formatNotificationMessage(notifType, referenceID st
 		return "liked your post", "/post/" + referenceID
 	case "new_comment":
 		return "commented on your post", "/post/" + referenceID
+	case "comment_reply":
+		return "replied to your comment", "/post/" + referenceID
 	case "new_message":
 		return "sent you a message", "/chat/" + referenceID
 	case "group_invite":
@@ -141,6 +156,19 @@ func (nm *NotificationModel) formatNotificationMessage(notifType, referenceID st
 	}
 }
 
+// reactionMessage describes a new_like notification from the reaction and
+// whether it was left on a post or a comment
+func reactionMessage(reaction, likeableType string) string {
+	target := "your post"
+	if likeableType == "comment" {
+		target = "your comment"
+	}
+	if reaction == "" || reaction == "like" {
+		return "liked " + target
+	}
+	return "reacted with " + reaction + " to " + target
+}
+
 func (nm *NotificationModel) MarkAsRead(ctx context.Context, notificationID, userID string) error {
 	query := `
 		UPDATE notifications 
@@ -180,7 +208,7 @@ func (nm *NotificationModel) getActorInfo(ctx context.Context, notifType, refere
 	var nickname, avatar string
 	
 	switch notifType {
-	case "new_like", "new_comment":
+	case "new_like", "new_comment", "comment_reply":
 		// For likes and comments, we need to get the actor from the additional data
 		// This is more complex, so for now return empty strings
 		// You could store actor_id in notifications table for better performance
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	// MaxPostMedia is the most media items a post's gallery can hold
+	MaxPostMedia = 10
+	// MaxAltTextLength bounds the alt text of a gallery item, in characters
+	MaxAltTextLength = 1000
+)
+
+var (
+	ErrTooManyMedia   = fmt.Errorf("a post can have at most %d media items", MaxPostMedia)
+	ErrMissingMediaID = errors.New("media_id is required")
+	ErrMediaNotOwned  = errors.New("media not found or not uploaded by the author")
+	ErrDuplicateMedia = errors.New("a media item can appear only once in a gallery")
+	ErrAltTextTooLong = fmt.Errorf("alt text can be at most %d characters", MaxAltTextLength)
+)
+
+// PostMediaInput references an uploaded media item to show in a post's gallery
+type PostMediaInput struct {
+	MediaID string `json:"media_id"`
+	AltText string `json:"alt_text"`
+}
+
+// PostMedia is one item of a post's gallery
+type PostMedia struct {
+	Media
+	Position int    `json:"position"`
+	AltText  string `json:"alt_text"`
+}
+
+// validateGallery checks a gallery before any media is looked up
+func validateGallery(items []PostMediaInput) error {
+	if len(items) > MaxPostMedia {
+		return ErrTooManyMedia
+	}
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		if item.MediaID == "" {
+			return ErrMissingMediaID
+		}
+		if seen[item.MediaID] {
+			return ErrDuplicateMedia
+		}
+		seen[item.MediaID] = true
+		if utf8.RuneCountInString(item.AltText) > MaxAltTextLength {
+			return ErrAltTextTooLong
+		}
+	}
+	return nil
+}
+
+// setPostMedia replaces the gallery of a post with items, in order. Every item
+// must have been uploaded by ownerID; missing media report the same error so
+// other users' media ids cannot be probed.
+func setPostMedia(tx *sql.Tx, ctx context.Context, postID, ownerID string, items []PostMediaInput) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_media WHERE post_id = ?`, postID); err != nil {
+		return fmt.Errorf("failed to clear gallery: %w", err)
+	}
+
+	for i, item := range items {
+		var owner string
+		err := tx.QueryRowContext(ctx, `SELECT owner_id FROM media WHERE id = ?`, item.MediaID).Scan(&owner)
+		if err == sql.ErrNoRows || (err == nil && owner != ownerID) {
+			return ErrMediaNotOwned
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load media %s: %w", item.MediaID, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO post_media (post_id, media_id, position, alt_text)
+			VALUES (?, ?, ?, ?)`, postID, item.MediaID, i, item.AltText)
+		if err != nil {
+			return fmt.Errorf("failed to insert media %s: %w", item.MediaID, err)
+		}
+	}
+	return nil
+}
+
+// saveRevisionMedia copies the current gallery of a post to one of its revisions
+func saveRevisionMedia(tx *sql.Tx, ctx context.Context, revisionID, postID string) error {
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO post_revision_media (revision_id, media_id, position, alt_text)
+		SELECT ?, media_id, position, alt_text FROM post_media WHERE post_id = ?`,
+		revisionID, postID)
+	if err != nil {
+		return fmt.Errorf("failed to save revision gallery: %w", err)
+	}
+	return nil
+}
+
+// AttachPostMedia fills in the gallery of each post
+func AttachPostMedia(db *sql.DB, ctx context.Context, posts []Post) error {
+	ids := make([]string, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+	galleries, err := loadGalleries(db, ctx, "post_media", "post_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].Media = galleries[posts[i].ID]
+	}
+	return nil
+}
+
+// attachRevisionMedia fills in the gallery each revision was shown with
+func attachRevisionMedia(db *sql.DB, ctx context.Context, revisions []PostRevision) error {
+	ids := make([]string, len(revisions))
+	for i := range revisions {
+		ids[i] = revisions[i].ID
+	}
+	galleries, err := loadGalleries(db, ctx, "post_revision_media", "revision_id", ids)
+	if err != nil {
+		return err
+	}
+	for i := range revisions {
+		revisions[i].Media = galleries[revisions[i].ID]
+	}
+	return nil
+}
+
+// loadGalleries returns the ordered gallery stored in table for each id, an
+// empty one for ids without media
+func loadGalleries(db *sql.DB, ctx context.Context, table, column string, ids []string) (map[string][]PostMedia, error) {
+	galleries := make(map[string][]PostMedia, len(ids))
+	if len(ids) == 0 {
+		return galleries, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+		galleries[id] = []PostMedia{}
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT g.`+column+`, g.position, g.alt_text,
+		       m.id, m.owner_id, m.kind, m.mime_type, m.size, m.width, m.height, m.sha256,
+		       m.filename, m.medium_filename, m.thumbnail_filename, m.created_at
+		FROM `+table+` g
+		JOIN media m ON m.id = g.media_id
+		WHERE g.`+column+` IN (`+placeholders(len(ids))+`)
+		ORDER BY g.`+column+`, g.position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var item PostMedia
+		m := &item.Media
+		err := rows.Scan(&id, &item.Position, &item.AltText,
+			&m.ID, &m.OwnerID, &m.Kind, &m.MimeType, &m.Size, &m.Width, &m.Height, &m.SHA256,
+			&m.Filename, &m.MediumFilename, &m.ThumbnailFilename, &m.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		m.setURLs()
+		galleries[id] = append(galleries[id], item)
+	}
+	return galleries, rows.Err()
+}
@@ -10,24 +10,43 @@ import (
 	"github.com/google/uuid"
 )
 
-func CreatePost(db *sql.DB, ctx context.Context, userID, content, privacy string, groupID *string, allowedUserIDs []string, imageURL *string) (string, error) {
-	if content == "" && imageURL == nil {
-		return "", errors.New("content or image is required")
+var (
+	ErrNotPostAuthor       = errors.New("only the author can edit this post")
+	ErrRestoreWindowPassed = errors.New("post can no longer be restored")
+
+	// Validation errors whose messages are meant for the client
+	ErrEmptyPost      = errors.New("content, image or media is required")
+	ErrInvalidPrivacy = errors.New("invalid privacy setting")
+	ErrNoAllowedUsers = errors.New("private posts must specify at least one allowed user")
+)
+
+// validatePost checks the fields shared by new and edited posts
+func validatePost(content, privacy string, allowedUserIDs []string, imageURL *string, media []PostMediaInput) error {
+	if content == "" && imageURL == nil && len(media) == 0 {
+		return ErrEmptyPost
+	}
+	if err := validateGallery(media); err != nil {
+		return err
 	}
 
 	// Validate privacy setting
-	isValidPrivacy := false
 	switch privacy {
 	case "public", "almost_private", "private":
-		isValidPrivacy = true
-	}
-	if !isValidPrivacy {
-		return "", errors.New("invalid privacy setting")
+	default:
+		return ErrInvalidPrivacy
 	}
 
 	// If privacy is private, the allowed users list must not be empty
 	if privacy == "private" && len(allowedUserIDs) == 0 {
-		return "", errors.New("private posts must specify at least one allowed user")
+		return ErrNoAllowedUsers
+	}
+	return nil
+}
+
+// CreatePost inserts a post with its gallery; media must have been uploaded by userID
+func CreatePost(db *sql.DB, ctx context.Context, userID, content, privacy string, groupID *string, allowedUserIDs []string, imageURL *string, media []PostMediaInput) (string, error) {
+	if err := validatePost(content, privacy, allowedUserIDs, imageURL, media); err != nil {
+		return "", err
 	}
 
 	// --- Start Transaction ---
@@ -48,8 +67,13 @@ func CreatePost(db *sql.DB, ctx context.Context, userID, content, privacy string
 	if err != nil {
 		return "", fmt.Errorf("failed to insert post: %w", err)
 	}
+
+	// --- 2. Attach the gallery ---
+	if err := setPostMedia(tx, ctx, postID, userID, media); err != nil {
+		return "", err
+	}
 	
-	// --- 2. If the post is private, insert into post_allowed_users ---
+	// --- 3. If the post is private, insert into post_allowed_users ---
 	if privacy == "private" {
 		allowedUsersStm, err := tx.PrepareContext(ctx, `INSERT INTO post_allowed_users (post_id, user_id) VALUES (?, ?)`)
 		if err != nil {
@@ -74,10 +98,13 @@ func CreatePost(db *sql.DB, ctx context.Context, userID, content, privacy string
 	return postID, nil
 }
 
-// GetFeed retrieves posts from users the given user follows
+// GetFollowingPosts retrieves visible posts from users the given user follows
+// and has not muted
 func GetFollowingPosts(db *sql.DB, userID string) ([]Post, error) {
+	visible, visibleArgs := PostVisibleSQL("p", userID)
+	muted, mutedArgs := MutedSQL("p.user_id", userID)
 	stm := `
-		SELECT p.id, p.user_id, p.content, p.privacy, p.created_at,
+		SELECT p.id, p.user_id, p.content, p.privacy, p.created_at, p.edited_at,
 		       (SELECT COUNT(*) FROM likes 
 		        WHERE likeable_type = 'post' AND likeable_id = p.id AND deleted_at IS NULL) as likes_count,
 		       EXISTS(SELECT 1 FROM likes 
@@ -85,16 +112,14 @@ func GetFollowingPosts(db *sql.DB, userID string) ([]Post, error) {
 		              AND user_id = ? AND deleted_at IS NULL) as user_liked
 	FROM posts p
 		JOIN follows f ON p.user_id = f.followed_id
-		WHERE f.follower_id = ? AND f.status = 'accepted'
-		  AND (p.privacy = 'public' 
-		       OR (p.privacy = 'almost_private' AND EXISTS(
-		             SELECT 1 FROM follows 
-		             WHERE follower_id = p.user_id AND followed_id = ? AND status = 'accepted'
-		          ))
-		       OR p.user_id = ?)
+		WHERE f.follower_id = ? AND f.status = 'accepted' AND f.deleted_at IS NULL
+		  AND ` + visible + `
+		  AND NOT ` + muted + `
 		ORDER BY p.created_at DESC;
 	`
-	rows, err := db.Query(stm, userID, userID, userID, userID)
+	args := append([]interface{}{userID, userID}, visibleArgs...)
+	args = append(args, mutedArgs...)
+	rows, err := db.Query(stm, args...)
 	if err != nil {
 		return []Post{}, err
 	}
@@ -104,24 +129,36 @@ func GetFollowingPosts(db *sql.DB, userID string) ([]Post, error) {
 
 	for rows.Next() {
 		var post Post
-		err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.Privacy, &post.CreatedAt, &post.LikesCount, &post.UserLiked)
+		var editedAt sql.NullInt64
+		err := rows.Scan(&post.ID, &post.UserID, &post.Content, &post.Privacy, &post.CreatedAt, &editedAt, &post.LikesCount, &post.UserLiked)
 		if err != nil {
 			return nil, err
 		}
+		if editedAt.Valid {
+			post.EditedAt = &editedAt.Int64
+			post.Edited = true
+		}
 		posts = append(posts, post)
 	}
 	if posts == nil {
 		return []Post{}, nil
 	}
+	if err := AttachPostReactions(db, context.Background(), userID, posts); err != nil {
+		return nil, err
+	}
+	if err := AttachPostMedia(db, context.Background(), posts); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
+// DeletePost soft deletes a post; it can be restored until it is purged
 func DeletePost(db *sql.DB, postID, userID string) error {
 	stmt := `
-		DELETE FROM posts
-		WHERE id = ? AND user_id = ?;
+		UPDATE posts SET deleted_at = ?
+		WHERE id = ? AND user_id = ? AND deleted_at IS NULL;
 `
-	result, err := db.Exec(stmt, postID, userID)
+	result, err := db.Exec(stmt, time.Now().Unix(), postID, userID)
 	if err != nil {
 		return err
 	}
@@ -130,51 +167,257 @@ func DeletePost(db *sql.DB, postID, userID string) error {
 		return err
 	}
 	if rows == 0 {
-		return errors.New("post not found or not owned by user")
+		return ErrPostNotFound
 	}
 
 	return nil
 }
 
-func GetAllPosts(db *sql.DB, userID string) ([]Post, error) {
-	query := `
-        SELECT 
-            p.id, 
-            p.user_id, 
-            p.group_id, 
-            p.content, 
-            p.privacy, 
-            p.created_at, 
-            p.updated_at, 
-            p.deleted_at,
-            COUNT(l.id) AS likes_count,
-            MAX(CASE WHEN l.user_id = $1 AND l.deleted_at IS NULL THEN 1 ELSE 0 END) AS user_liked
-        FROM posts p
-        LEFT JOIN likes l ON 
-            p.id = l.likeable_id AND 
-            l.likeable_type = 'post'
-        WHERE p.deleted_at IS NULL
-        GROUP BY 
-            p.id, p.user_id, p.group_id, p.content, p.privacy,
-            p.created_at, p.updated_at, p.deleted_at
-        ORDER BY p.created_at DESC
-    `
-
-	rows, err := db.Query(query, userID)
+// RestorePost undoes a soft delete made by the author within the restore window
+func RestorePost(db *sql.DB, ctx context.Context, postID, userID string, window time.Duration) error {
+	var deletedAt sql.NullInt64
+	err := db.QueryRowContext(ctx, `SELECT deleted_at FROM posts WHERE id = ? AND user_id = ?`, postID, userID).Scan(&deletedAt)
+	if err == sql.ErrNoRows || (err == nil && !deletedAt.Valid) {
+		return ErrPostNotFound
+	}
 	if err != nil {
-		return nil, fmt.Errorf("database query error: %v", err)
+		return err
+	}
+	if time.Since(time.Unix(deletedAt.Int64, 0)) > window {
+		return ErrRestoreWindowPassed
 	}
-	defer rows.Close()
 
-	var posts []Post
+	_, err = db.ExecContext(ctx, `UPDATE posts SET deleted_at = NULL WHERE id = ? AND user_id = ?`, postID, userID)
+	return err
+}
+
+// PurgeDeletedPosts hard deletes posts soft deleted before cutoff together with
+// their comments, likes, notifications and other rows that point at them.
+// It returns the number of posts removed and the image URLs that are no longer
+// referenced anywhere, so the caller can delete the files.
+func PurgeDeletedPosts(db *sql.DB, ctx context.Context, cutoff time.Time) (int64, []string, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const purged = `SELECT id FROM posts WHERE deleted_at IS NOT NULL AND deleted_at < ?`
+	const purgedComments = `SELECT id FROM comments WHERE post_id IN (` + purged + `)`
+	ts := cutoff.Unix()
+
+	// Collect images before the rows that reference them disappear
+	rows, err := tx.QueryContext(ctx, `
+		SELECT image_url FROM posts WHERE image_url IS NOT NULL AND id IN (`+purged+`)
+		UNION SELECT image_url FROM comments WHERE image_url IS NOT NULL AND post_id IN (`+purged+`)
+		UNION SELECT image_url FROM post_revisions WHERE image_url IS NOT NULL AND post_id IN (`+purged+`)
+		UNION SELECT ? || m.filename FROM post_media pm JOIN media m ON m.id = pm.media_id
+		      WHERE pm.post_id IN (`+purged+`)
+		UNION SELECT ? || m.filename FROM post_revision_media prm JOIN media m ON m.id = prm.media_id
+		      WHERE prm.revision_id IN (SELECT id FROM post_revisions WHERE post_id IN (`+purged+`))`,
+		ts, ts, ts, UploadsPrefix, ts, UploadsPrefix, ts)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to collect images: %w", err)
+	}
+	var images []string
 	for rows.Next() {
-		var post Post
-		err := rows.Scan(&post.ID, &post.UserID, &post.GroupID, &post.Content, &post.Privacy, &post.CreatedAt, &post.UpdatedAt, &post.DeletedAt, &post.LikesCount, &post.UserLiked)
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		images = append(images, url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	// Dependent rows first; foreign key cascades are not enabled on the connection
+	cleanup := []struct {
+		stmt string
+		args int
+	}{
+		{`DELETE FROM likes WHERE (likeable_type = 'post' AND likeable_id IN (` + purged + `))
+		     OR (likeable_type = 'comment' AND likeable_id IN (` + purgedComments + `))`, 2},
+		{`DELETE FROM notifications WHERE reference_id IN (` + purged + `)
+		     OR reference_id IN (` + purgedComments + `)`, 2},
+		{`DELETE FROM comments WHERE post_id IN (` + purged + `)`, 1},
+		{`DELETE FROM post_allowed_users WHERE post_id IN (` + purged + `)`, 1},
+		{`DELETE FROM post_media WHERE post_id IN (` + purged + `)`, 1},
+		{`DELETE FROM post_revision_media WHERE revision_id IN (
+		     SELECT id FROM post_revisions WHERE post_id IN (` + purged + `))`, 1},
+		{`DELETE FROM post_revisions WHERE post_id IN (` + purged + `)`, 1},
+		{`DELETE FROM group_posts WHERE post_id IN (` + purged + `)`, 1},
+	}
+	for _, c := range cleanup {
+		args := make([]interface{}, c.args)
+		for i := range args {
+			args[i] = ts
+		}
+		if _, err := tx.ExecContext(ctx, c.stmt, args...); err != nil {
+			return 0, nil, fmt.Errorf("failed to clean up deleted posts: %w", err)
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE deleted_at IS NOT NULL AND deleted_at < ?`, ts)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to purge posts: %w", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Keep any image that is still used elsewhere
+	var orphaned []string
+	for _, url := range images {
+		var inUse bool
+		err := tx.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM posts WHERE image_url = ?)
+			    OR EXISTS(SELECT 1 FROM comments WHERE image_url = ?)
+			    OR EXISTS(SELECT 1 FROM post_revisions WHERE image_url = ?)
+			    OR EXISTS(SELECT 1 FROM users WHERE avatar_url = ?)
+			    OR EXISTS(SELECT 1 FROM post_media pm JOIN media m ON m.id = pm.media_id
+			              WHERE ? || m.filename = ?)
+			    OR EXISTS(SELECT 1 FROM post_revision_media prm JOIN media m ON m.id = prm.media_id
+			              WHERE ? || m.filename = ?)`,
+			url, url, url, url, UploadsPrefix, url, UploadsPrefix, url).Scan(&inUse)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning post: %v", err)
+			return 0, nil, fmt.Errorf("failed to check image usage: %w", err)
+		}
+		if !inUse {
+			orphaned = append(orphaned, url)
 		}
-		posts = append(posts, post)
 	}
 
-	return posts, nil
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return count, orphaned, nil
+}
+
+// UpdatePost replaces a post's content, image, gallery and privacy, keeping
+// the previous version in post_revisions. Group posts keep their privacy since
+// visibility there is decided by group membership.
+func UpdatePost(db *sql.DB, ctx context.Context, postID, userID, content, privacy string, allowedUserIDs []string, imageURL *string, media []PostMediaInput) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var authorID, oldContent, oldPrivacy string
+	var groupID, oldImageURL sql.NullString
+	err = tx.QueryRowContext(ctx, `
+		SELECT user_id, group_id, content, privacy, image_url
+		FROM posts WHERE id = ? AND deleted_at IS NULL`, postID).Scan(
+		&authorID, &groupID, &oldContent, &oldPrivacy, &oldImageURL)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load post: %w", err)
+	}
+	if authorID != userID {
+		return ErrNotPostAuthor
+	}
+
+	if groupID.Valid {
+		if content == "" && imageURL == nil && len(media) == 0 {
+			return ErrEmptyPost
+		}
+		if err := validateGallery(media); err != nil {
+			return err
+		}
+		privacy = oldPrivacy
+	} else if err := validatePost(content, privacy, allowedUserIDs, imageURL, media); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	// --- 1. Keep the current version as a revision ---
+	revisionID := uuid.New().String()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_revisions (id, post_id, editor_id, content, image_url, privacy, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		revisionID, postID, userID, oldContent, oldImageURL, oldPrivacy, now)
+	if err != nil {
+		return fmt.Errorf("failed to insert revision: %w", err)
+	}
+	if err := saveRevisionMedia(tx, ctx, revisionID, postID); err != nil {
+		return err
+	}
+
+	// --- 2. Apply the edit ---
+	_, err = tx.ExecContext(ctx, `
+		UPDATE posts SET content = ?, privacy = ?, image_url = ?, updated_at = ?, edited_at = ?
+		WHERE id = ?`,
+		content, privacy, imageURL, now, now, postID)
+	if err != nil {
+		return fmt.Errorf("failed to update post: %w", err)
+	}
+	if err := setPostMedia(tx, ctx, postID, userID, media); err != nil {
+		return err
+	}
+
+	// --- 3. Recompute the audience of private posts ---
+	if !groupID.Valid {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM post_allowed_users WHERE post_id = ?`, postID); err != nil {
+			return fmt.Errorf("failed to clear allowed users: %w", err)
+		}
+		if privacy == "private" {
+			allowedUsersStm, err := tx.PrepareContext(ctx, `INSERT INTO post_allowed_users (post_id, user_id) VALUES (?, ?)`)
+			if err != nil {
+				return fmt.Errorf("failed to prepare statement for allowed users: %w", err)
+			}
+			defer allowedUsersStm.Close()
+
+			for _, allowedID := range allowedUserIDs {
+				if _, err := allowedUsersStm.ExecContext(ctx, postID, allowedID); err != nil {
+					return fmt.Errorf("failed to insert allowed user %s: %w", allowedID, err)
+				}
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetPostRevisions returns the previous versions of a post, newest first
+func GetPostRevisions(db *sql.DB, ctx context.Context, postID string) ([]PostRevision, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, post_id, editor_id, content, image_url, privacy, created_at
+		FROM post_revisions
+		WHERE post_id = ?
+		ORDER BY created_at DESC, rowid DESC`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		var imageURL sql.NullString
+		if err := rows.Scan(&rev.ID, &rev.PostID, &rev.EditorID, &rev.Content, &imageURL, &rev.Privacy, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if imageURL.Valid {
+			rev.ImageURL = &imageURL.String
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := attachRevisionMedia(db, ctx, revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"strings"
@@ -25,6 +26,17 @@ func GetUser(db *sql.DB, viewerID, targetID string) (*User, []Post, []User, []Us
 		return nil, nil, nil, nil, err
 	}
 
+	// Users who blocked one another only see each other's name
+	if viewerID != targetID {
+		blocked, err := IsBlocked(db, context.Background(), viewerID, targetID)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		if blocked {
+			return &User{ID: user.ID, Nickname: user.Nickname}, nil, nil, nil, nil
+		}
+	}
+
 	canViewFull := viewerID == targetID || !user.IsPrivate
 	veiwStmt := `
 SELECT COUNT(*)
@@ -0,0 +1,340 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultReactions is the reaction set used unless configured otherwise
+var DefaultReactions = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+var allowedReactions = DefaultReactions
+
+var (
+	ErrInvalidReaction = errors.New("invalid reaction")
+	ErrAlreadyReacted  = errors.New("user already liked this content")
+)
+
+// SetReactions replaces the set of reactions users may choose from
+func SetReactions(reactions []string) {
+	if len(reactions) > 0 {
+		allowedReactions = reactions
+	}
+}
+
+// Reactions returns the configured reaction set
+func Reactions() []string {
+	return allowedReactions
+}
+
+// IsValidReaction reports whether reaction is in the configured set
+func IsValidReaction(reaction string) bool {
+	for _, r := range allowedReactions {
+		if r == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// Reactor is a user who reacted to a post or comment
+type Reactor struct {
+	UserID    string `json:"user_id"`
+	Nickname  string `json:"nickname"`
+	AvatarURL string `json:"avatar_url"`
+	Reaction  string `json:"reaction"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// React sets the user's reaction on a post or comment. A user has at most one
+// reaction per item; reacting again with a different reaction replaces it.
+// Only a brand new reaction notifies the content owner.
+func React(db *sql.DB, ctx context.Context, notificationModel *NotificationModel, hub NotificationSender, userID, likeableType, likeableID, reaction string) (*Like, error) {
+	if likeableType != "post" && likeableType != "comment" {
+		return nil, errors.New("invalid likeable type")
+	}
+	if !IsValidReaction(reaction) {
+		return nil, ErrInvalidReaction
+	}
+
+	var existingID, existingReaction string
+	var deletedAt *int64
+	err := db.QueryRowContext(ctx, `
+		SELECT id, reaction, deleted_at FROM likes
+		WHERE user_id = ? AND likeable_type = ? AND likeable_id = ?`,
+		userID, likeableType, likeableID).Scan(&existingID, &existingReaction, &deletedAt)
+
+	now := time.Now().Unix()
+	like := &Like{
+		UserID:       userID,
+		LikeableType: likeableType,
+		LikeableID:   likeableID,
+		Reaction:     reaction,
+		CreatedAt:    now,
+	}
+
+	switch {
+	case err == nil && deletedAt == nil && existingReaction == reaction:
+		return nil, ErrAlreadyReacted
+	case err == nil:
+		// Switch reaction, or reactivate a removed one
+		_, err := db.ExecContext(ctx,
+			`UPDATE likes SET reaction = ?, deleted_at = NULL, created_at = ? WHERE id = ?`,
+			reaction, now, existingID)
+		if err != nil {
+			return nil, err
+		}
+		like.ID = existingID
+		return like, nil
+	case err != sql.ErrNoRows:
+		return nil, err
+	}
+
+	like.ID = uuid.New().String()
+	_, err = db.ExecContext(ctx, `
+		INSERT INTO likes (id, user_id, likeable_type, likeable_id, reaction, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		like.ID, userID, likeableType, likeableID, reaction, now)
+	if err != nil {
+		return nil, err
+	}
+
+	notifyReaction(db, ctx, notificationModel, hub, like)
+	return like, nil
+}
+
+// notifyReaction tells the owner of the post or comment about a new reaction
+func notifyReaction(db *sql.DB, ctx context.Context, notificationModel *NotificationModel, hub NotificationSender, like *Like) {
+	if notificationModel == nil {
+		return
+	}
+
+	// Comment reactions link to the post for navigation
+	var ownerID, postID string
+	var err error
+	if like.LikeableType == "post" {
+		postID = like.LikeableID
+		err = db.QueryRowContext(ctx, `SELECT user_id FROM posts WHERE id = ?`, postID).Scan(&ownerID)
+	} else {
+		err = db.QueryRowContext(ctx, `SELECT user_id, post_id FROM comments WHERE id = ?`, like.LikeableID).Scan(&ownerID, &postID)
+	}
+	if err != nil {
+		log.Printf("ERROR: Failed to get %s owner for reaction notification: %v", like.LikeableType, err)
+		return
+	}
+	if ownerID == like.UserID {
+		log.Printf("DEBUG: Not creating like notification - self-reaction detected")
+		return
+	}
+
+	actorID, reaction, likeableType := like.UserID, like.Reaction, like.LikeableType
+	notification := Notification{
+		ID:           uuid.New().String(),
+		UserID:       ownerID,
+		Type:         "new_like",
+		ReferenceID:  postID,
+		ActorID:      &actorID, // Store who performed the action
+		Reaction:     &reaction,
+		LikeableType: &likeableType,
+		IsRead:       false,
+		CreatedAt:    time.Now(),
+	}
+	if _, err := notificationModel.Insert(ctx, notification); err != nil {
+		log.Printf("ERROR: Failed to create notification for reaction: %v", err)
+		return
+	}
+	log.Printf("SUCCESS: Reaction notification created for %s owner: %s", like.LikeableType, ownerID)
+
+	// Send real-time notification if hub is available
+	if hub != nil {
+		var nickname, avatar string
+		db.QueryRowContext(ctx, "SELECT nickname, avatar_url FROM users WHERE id = ?", actorID).Scan(&nickname, &avatar)
+
+		metadata := map[string]interface{}{
+			"post_id":        postID,
+			"liker_id":       actorID,
+			"reaction":       reaction,
+			"likeable_type":  likeableType,
+			"actor_nickname": nickname,
+			"actor_avatar":   avatar,
+		}
+		if like.LikeableType == "comment" {
+			metadata["comment_id"] = like.LikeableID
+		}
+		hub.SendNotification(ownerID, notification, metadata)
+	}
+}
+
+// GetReactionCounts returns the number of each reaction for every given item
+func GetReactionCounts(db *sql.DB, ctx context.Context, likeableType string, ids []string) (map[string]map[string]int, error) {
+	counts := make(map[string]map[string]int, len(ids))
+	if len(ids) == 0 {
+		return counts, nil
+	}
+
+	args := []interface{}{likeableType}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT likeable_id, reaction, COUNT(*)
+		FROM likes
+		WHERE likeable_type = ? AND deleted_at IS NULL
+		AND likeable_id IN (`+placeholders(len(ids))+`)
+		GROUP BY likeable_id, reaction`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, reaction string
+		var n int
+		if err := rows.Scan(&id, &reaction, &n); err != nil {
+			return nil, err
+		}
+		if counts[id] == nil {
+			counts[id] = make(map[string]int)
+		}
+		counts[id][reaction] = n
+	}
+	return counts, rows.Err()
+}
+
+// GetUserReactions returns the user's reaction on each of the given items that they reacted to
+func GetUserReactions(db *sql.DB, ctx context.Context, userID, likeableType string, ids []string) (map[string]string, error) {
+	reactions := make(map[string]string)
+	if len(ids) == 0 {
+		return reactions, nil
+	}
+
+	args := []interface{}{userID, likeableType}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT likeable_id, reaction
+		FROM likes
+		WHERE user_id = ? AND likeable_type = ? AND deleted_at IS NULL
+		AND likeable_id IN (`+placeholders(len(ids))+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, reaction string
+		if err := rows.Scan(&id, &reaction); err != nil {
+			return nil, err
+		}
+		reactions[id] = reaction
+	}
+	return reactions, rows.Err()
+}
+
+// AttachPostReactions fills in reaction counts and the viewer's reaction on posts.
+// LikesCount becomes the total of all reactions.
+func AttachPostReactions(db *sql.DB, ctx context.Context, viewerID string, posts []Post) error {
+	ids := make([]string, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	counts, err := GetReactionCounts(db, ctx, "post", ids)
+	if err != nil {
+		return err
+	}
+	mine, err := GetUserReactions(db, ctx, viewerID, "post", ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].ReactionCounts = counts[posts[i].ID]
+		posts[i].LikesCount = 0
+		for _, n := range posts[i].ReactionCounts {
+			posts[i].LikesCount += n
+		}
+		if r, ok := mine[posts[i].ID]; ok {
+			posts[i].UserReaction = &r
+		}
+		posts[i].UserLiked = posts[i].UserReaction != nil
+	}
+	return nil
+}
+
+// attachCommentReactions fills in reaction counts and the viewer's reaction on comments
+func attachCommentReactions(db *sql.DB, ctx context.Context, viewerID string, comments []Comment) error {
+	ids := make([]string, len(comments))
+	for i := range comments {
+		ids[i] = comments[i].ID
+	}
+
+	counts, err := GetReactionCounts(db, ctx, "comment", ids)
+	if err != nil {
+		return err
+	}
+	mine, err := GetUserReactions(db, ctx, viewerID, "comment", ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range comments {
+		comments[i].ReactionCounts = counts[comments[i].ID]
+		comments[i].LikesCount = 0
+		for _, n := range comments[i].ReactionCounts {
+			comments[i].LikesCount += n
+		}
+		if r, ok := mine[comments[i].ID]; ok {
+			comments[i].UserReaction = &r
+		}
+		comments[i].UserLiked = comments[i].UserReaction != nil
+	}
+	return nil
+}
+
+// GetReactors lists who reacted to an item, newest first, optionally only with
+// one reaction. Users the viewer blocked or was blocked by are left out.
+func GetReactors(db *sql.DB, ctx context.Context, viewerID, likeableType, likeableID, reaction string, limit, offset int) ([]Reactor, error) {
+	blocked, blockedArgs := BlockedSQL("l.user_id", viewerID)
+	stmt := `
+		SELECT l.user_id, u.nickname, COALESCE(u.avatar_url, ''), l.reaction, l.created_at
+		FROM likes l
+		JOIN users u ON u.id = l.user_id
+		WHERE l.likeable_type = ? AND l.likeable_id = ? AND l.deleted_at IS NULL
+		AND NOT ` + blocked
+	args := append([]interface{}{likeableType, likeableID}, blockedArgs...)
+	if reaction != "" {
+		stmt += ` AND l.reaction = ?`
+		args = append(args, reaction)
+	}
+	stmt += ` ORDER BY l.created_at DESC, l.rowid DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	rows, err := db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactors := []Reactor{}
+	for rows.Next() {
+		var r Reactor
+		if err := rows.Scan(&r.UserID, &r.Nickname, &r.AvatarURL, &r.Reaction, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		reactors = append(reactors, r)
+	}
+	return reactors, rows.Err()
+}
+
+// placeholders returns "?, ?, ..." with n entries
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// TestGetReactorsHidesBlockedUsers checks that users blocked either way are
+// missing from each other's reactor lists
+func TestGetReactorsHidesBlockedUsers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	fixture := []string{
+		`INSERT INTO users (id, email, password_hash, nickname, created_at, updated_at) VALUES ('author', 'author@test', 'x', 'author', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, nickname, created_at, updated_at) VALUES ('blocker', 'blocker@test', 'x', 'blocker', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, nickname, created_at, updated_at) VALUES ('blocked', 'blocked@test', 'x', 'blocked', 1, 1)`,
+		`INSERT INTO posts (id, user_id, content, privacy, created_at, updated_at) VALUES ('post', 'author', 'c', 'public', 1, 1)`,
+		`INSERT INTO likes (id, user_id, likeable_type, likeable_id, reaction, created_at) VALUES ('l1', 'blocker', 'post', 'post', 'like', 1)`,
+		`INSERT INTO likes (id, user_id, likeable_type, likeable_id, reaction, created_at) VALUES ('l2', 'blocked', 'post', 'post', 'like', 2)`,
+		`INSERT INTO blocks (blocker_id, blocked_id, kind, created_at) VALUES ('blocker', 'blocked', 'block', 1)`,
+	}
+	for _, stmt := range fixture {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	for viewer, want := range map[string][]string{
+		"author":  {"blocked", "blocker"},
+		"blocker": {"blocker"},
+		"blocked": {"blocked"},
+	} {
+		for _, reaction := range []string{"", "like"} {
+			reactors, err := GetReactors(db, ctx, viewer, "post", "post", reaction, 10, 0)
+			if err != nil {
+				t.Fatalf("GetReactors failed: %v", err)
+			}
+			var got []string
+			for _, r := range reactors {
+				got = append(got, r.UserID)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("GetReactors(%s, %q) = %v, want %v", viewer, reaction, got, want)
+			}
+		}
+	}
+}
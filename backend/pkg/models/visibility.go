@@ -0,0 +1,203 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var ErrPostNotFound = errors.New("post not found or access denied")
+
+// PostAudience describes how a viewer relates to a post's author and group.
+// It carries the facts CanViewPost needs so the policy itself stays pure.
+type PostAudience struct {
+	ViewerID      string
+	FollowsAuthor bool // accepted, non-deleted follow of the post author
+	AllowedUser   bool // listed in post_allowed_users for the post
+	GroupMember   bool // active member of the post's group
+	Blocked       bool // the viewer or the author blocked the other
+}
+
+// CanViewPost is the single visibility policy for posts:
+//   - deleted posts are visible to nobody
+//   - authors always see their own posts
+//   - posts are hidden between users who blocked one another
+//   - group posts are visible to active members of the group
+//   - public posts are visible to everyone
+//   - almost_private posts are visible to accepted followers of the author
+//   - private posts are visible to the users chosen by the author
+//
+// PostVisibleSQL must implement the same rules for list queries.
+func CanViewPost(viewer PostAudience, post Post) bool {
+	if post.DeletedAt != nil {
+		return false
+	}
+	if viewer.ViewerID != "" && post.UserID == viewer.ViewerID {
+		return true
+	}
+	if viewer.Blocked {
+		return false
+	}
+	if post.GroupID != nil {
+		return viewer.GroupMember
+	}
+
+	switch post.Privacy {
+	case "public":
+		return true
+	case "almost_private":
+		return viewer.FollowsAuthor
+	case "private":
+		return viewer.AllowedUser
+	}
+	return false
+}
+
+// PostVisibleSQL returns a WHERE fragment that is true for posts (aliased as
+// alias) the viewer may see, along with its arguments in placeholder order.
+func PostVisibleSQL(alias, viewerID string) (string, []interface{}) {
+	p := alias + "."
+	fragment := `(` + p + `deleted_at IS NULL AND (
+		` + p + `user_id = ?
+		OR (NOT EXISTS(
+			SELECT 1 FROM blocks vis_b
+			WHERE vis_b.kind = 'block'
+			AND ((vis_b.blocker_id = ? AND vis_b.blocked_id = ` + p + `user_id)
+			  OR (vis_b.blocker_id = ` + p + `user_id AND vis_b.blocked_id = ?))
+		) AND (
+			(` + p + `group_id IS NOT NULL AND EXISTS(
+				SELECT 1 FROM group_members vis_gm
+				WHERE vis_gm.group_id = ` + p + `group_id AND vis_gm.user_id = ? AND vis_gm.deleted_at IS NULL
+			))
+			OR (` + p + `group_id IS NULL AND (
+				` + p + `privacy = 'public'
+				OR (` + p + `privacy = 'almost_private' AND EXISTS(
+					SELECT 1 FROM follows vis_f
+					WHERE vis_f.follower_id = ? AND vis_f.followed_id = ` + p + `user_id
+					AND vis_f.status = 'accepted' AND vis_f.deleted_at IS NULL
+				))
+				OR (` + p + `privacy = 'private' AND EXISTS(
+					SELECT 1 FROM post_allowed_users vis_pau
+					WHERE vis_pau.post_id = ` + p + `id AND vis_pau.user_id = ?
+				))
+			))
+		))
+	))`
+	return fragment, []interface{}{viewerID, viewerID, viewerID, viewerID, viewerID, viewerID}
+}
+
+// GetPostAudience loads the post and the viewer's relationship to it
+func GetPostAudience(db *sql.DB, ctx context.Context, viewerID, postID string) (*Post, *PostAudience, error) {
+	blocked, blockedArgs := BlockedSQL("p.user_id", viewerID)
+	stmt := `
+		SELECT p.id, p.user_id, p.group_id, p.privacy, p.deleted_at,
+		       EXISTS(SELECT 1 FROM follows
+		              WHERE follower_id = ? AND followed_id = p.user_id
+		              AND status = 'accepted' AND deleted_at IS NULL),
+		       EXISTS(SELECT 1 FROM post_allowed_users
+		              WHERE post_id = p.id AND user_id = ?),
+		       EXISTS(SELECT 1 FROM group_members
+		              WHERE group_id = p.group_id AND user_id = ? AND deleted_at IS NULL),
+		       ` + blocked + `
+		FROM posts p
+		WHERE p.id = ?
+	`
+	var post Post
+	var groupID sql.NullString
+	var deletedAt sql.NullInt64
+	audience := PostAudience{ViewerID: viewerID}
+
+	args := append([]interface{}{viewerID, viewerID, viewerID}, blockedArgs...)
+	args = append(args, postID)
+	err := db.QueryRowContext(ctx, stmt, args...).Scan(
+		&post.ID, &post.UserID, &groupID, &post.Privacy, &deletedAt,
+		&audience.FollowsAuthor, &audience.AllowedUser, &audience.GroupMember, &audience.Blocked,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrPostNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if groupID.Valid {
+		post.GroupID = &groupID.String
+	}
+	if deletedAt.Valid {
+		post.DeletedAt = &deletedAt.Int64
+	}
+	return &post, &audience, nil
+}
+
+// CheckPostVisible returns ErrPostNotFound unless the viewer may see the post.
+// Missing and hidden posts are indistinguishable so existence is not leaked.
+func CheckPostVisible(db *sql.DB, ctx context.Context, viewerID, postID string) error {
+	post, audience, err := GetPostAudience(db, ctx, viewerID, postID)
+	if err != nil {
+		return err
+	}
+	if !CanViewPost(*audience, *post) {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// CheckCommentVisible returns ErrPostNotFound unless the comment exists, its
+// author and the viewer have not blocked one another, and the viewer may see
+// the post it belongs to
+func CheckCommentVisible(db *sql.DB, ctx context.Context, viewerID, commentID string) error {
+	blocked, blockedArgs := BlockedSQL("comments.user_id", viewerID)
+	var postID string
+	var isBlocked bool
+	err := db.QueryRowContext(ctx,
+		`SELECT post_id, `+blocked+` FROM comments WHERE id = ? AND deleted_at IS NULL`,
+		append(blockedArgs, commentID)...).Scan(&postID, &isBlocked)
+	if err == sql.ErrNoRows || isBlocked {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return CheckPostVisible(db, ctx, viewerID, postID)
+}
+
+// CanViewImage reports whether an uploaded image URL is attached to something
+// the viewer may see: a visible post or its gallery, a comment on a visible
+// post, or a profile avatar. Images only found in earlier revisions of a post
+// are shown to its author alone, as GetPostRevisions only answers the author.
+func CanViewImage(db *sql.DB, ctx context.Context, viewerID, imageURL string) (bool, error) {
+	postVisible, postArgs := PostVisibleSQL("p", viewerID)
+	commentVisible, commentArgs := PostVisibleSQL("cp", viewerID)
+	galleryVisible, galleryArgs := PostVisibleSQL("gp", viewerID)
+
+	stmt := `
+		SELECT EXISTS(SELECT 1 FROM users WHERE avatar_url = ?)
+		    OR EXISTS(SELECT 1 FROM posts p WHERE p.image_url = ? AND ` + postVisible + `)
+		    OR EXISTS(SELECT 1 FROM comments c JOIN posts cp ON c.post_id = cp.id
+		              WHERE c.image_url = ? AND c.deleted_at IS NULL AND ` + commentVisible + `)
+		    OR EXISTS(SELECT 1 FROM post_media pm
+		              JOIN media m ON m.id = pm.media_id
+		              JOIN posts gp ON gp.id = pm.post_id
+		              WHERE ? || m.filename = ? AND ` + galleryVisible + `)
+		    OR EXISTS(SELECT 1 FROM post_revisions r JOIN posts rp ON rp.id = r.post_id
+		              WHERE r.image_url = ? AND rp.user_id = ? AND rp.deleted_at IS NULL)
+		    OR EXISTS(SELECT 1 FROM post_revision_media rm
+		              JOIN media rmm ON rmm.id = rm.media_id
+		              JOIN post_revisions rr ON rr.id = rm.revision_id
+		              JOIN posts rgp ON rgp.id = rr.post_id
+		              WHERE ? || rmm.filename = ? AND rgp.user_id = ? AND rgp.deleted_at IS NULL)
+	`
+	args := []interface{}{imageURL, imageURL}
+	args = append(args, postArgs...)
+	args = append(args, imageURL)
+	args = append(args, commentArgs...)
+	args = append(args, UploadsPrefix, imageURL)
+	args = append(args, galleryArgs...)
+	args = append(args, imageURL, viewerID)
+	args = append(args, UploadsPrefix, imageURL, viewerID)
+
+	var visible bool
+	if err := db.QueryRowContext(ctx, stmt, args...).Scan(&visible); err != nil {
+		return false, err
+	}
+	return visible, nil
+}
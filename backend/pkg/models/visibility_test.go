@@ -0,0 +1,246 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"social-nework/pkg/db/sqlite"
+)
+
+// openTestDB returns a fresh database with every migration applied
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.NewDB(filepath.Join(t.TempDir(), "test.db"), "../db/migrations/sqlite")
+	if err != nil {
+		t.Fatalf("failed to open test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// visibilityCase is one viewer/post pair; the relationships are stored as
+// rows so PostVisibleSQL can be checked against the same fixture
+type visibilityCase struct {
+	name    string
+	deleted bool
+	author  bool   // the viewer wrote the post
+	blocked bool   // the viewer and the author blocked one another
+	group   string // "" for a profile post, else "member" or "outsider"
+	privacy string
+	follows bool // accepted follow of the author
+	allowed bool // listed in post_allowed_users
+	want    bool
+}
+
+var visibilityCases = []visibilityCase{
+	{name: "public", privacy: "public", want: true},
+	{name: "public deleted", deleted: true, privacy: "public", want: false},
+	{name: "public blocked", blocked: true, privacy: "public", want: false},
+	{name: "public blocked with follow", blocked: true, follows: true, privacy: "public", want: false},
+
+	{name: "almost_private stranger", privacy: "almost_private", want: false},
+	{name: "almost_private follower", privacy: "almost_private", follows: true, want: true},
+	{name: "almost_private allowed but not following", privacy: "almost_private", allowed: true, want: false},
+	{name: "almost_private follower deleted", deleted: true, privacy: "almost_private", follows: true, want: false},
+	{name: "almost_private follower blocked", blocked: true, privacy: "almost_private", follows: true, want: false},
+
+	{name: "private stranger", privacy: "private", want: false},
+	{name: "private follower not allowed", privacy: "private", follows: true, want: false},
+	{name: "private allowed", privacy: "private", allowed: true, want: true},
+	{name: "private allowed deleted", deleted: true, privacy: "private", allowed: true, want: false},
+	{name: "private allowed blocked", blocked: true, privacy: "private", allowed: true, want: false},
+
+	{name: "author public", author: true, privacy: "public", want: true},
+	{name: "author private", author: true, privacy: "private", want: true},
+	{name: "author deleted", author: true, deleted: true, privacy: "public", want: false},
+	{name: "author group outsider", author: true, group: "outsider", privacy: "public", want: true},
+
+	{name: "group member", group: "member", privacy: "public", want: true},
+	{name: "group member private post", group: "member", privacy: "private", want: true},
+	{name: "group outsider public post", group: "outsider", privacy: "public", want: false},
+	{name: "group outsider follower", group: "outsider", privacy: "almost_private", follows: true, want: false},
+	{name: "group member deleted", deleted: true, group: "member", privacy: "public", want: false},
+	{name: "group member blocked", blocked: true, group: "member", privacy: "public", want: false},
+}
+
+func TestCanViewPost(t *testing.T) {
+	for _, tc := range visibilityCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viewer, post := tc.audience()
+			if got := CanViewPost(viewer, post); got != tc.want {
+				t.Errorf("CanViewPost = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestPostVisibleSQL checks that list queries and single-post lookups agree
+// with CanViewPost on the same fixtures
+func TestPostVisibleSQL(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	for i, tc := range visibilityCases {
+		t.Run(tc.name, func(t *testing.T) {
+			viewerID, postID := tc.insert(t, db, i)
+
+			visible, args := PostVisibleSQL("p", viewerID)
+			var got bool
+			err := db.QueryRowContext(ctx,
+				`SELECT EXISTS(SELECT 1 FROM posts p WHERE p.id = ? AND `+visible+`)`,
+				append([]interface{}{postID}, args...)...).Scan(&got)
+			if err != nil {
+				t.Fatalf("query failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("PostVisibleSQL = %v, want %v", got, tc.want)
+			}
+
+			// Another alias must give the same answer
+			visible, args = PostVisibleSQL("other", viewerID)
+			err = db.QueryRowContext(ctx,
+				`SELECT EXISTS(SELECT 1 FROM posts other WHERE other.id = ? AND `+visible+`)`,
+				append([]interface{}{postID}, args...)...).Scan(&got)
+			if err != nil {
+				t.Fatalf("aliased query failed: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("PostVisibleSQL with alias other = %v, want %v", got, tc.want)
+			}
+
+			post, audience, err := GetPostAudience(db, ctx, viewerID, postID)
+			if err != nil {
+				t.Fatalf("GetPostAudience failed: %v", err)
+			}
+			if got := CanViewPost(*audience, *post); got != tc.want {
+				t.Errorf("CanViewPost on loaded audience = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// audience builds the policy inputs for the case
+func (tc visibilityCase) audience() (PostAudience, Post) {
+	viewer := PostAudience{
+		ViewerID:      "viewer",
+		FollowsAuthor: tc.follows,
+		AllowedUser:   tc.allowed,
+		GroupMember:   tc.group == "member",
+		Blocked:       tc.blocked,
+	}
+	post := Post{ID: "post", UserID: "author", Privacy: tc.privacy}
+	if tc.author {
+		post.UserID = viewer.ViewerID
+	}
+	if tc.deleted {
+		deletedAt := int64(1)
+		post.DeletedAt = &deletedAt
+	}
+	if tc.group != "" {
+		groupID := "group"
+		post.GroupID = &groupID
+	}
+	return viewer, post
+}
+
+// insert stores the case under ids unique to n and returns the viewer and post ids
+func (tc visibilityCase) insert(t *testing.T, db *sql.DB, n int) (string, string) {
+	t.Helper()
+	viewerID := fmt.Sprintf("viewer-%d", n)
+	authorID := fmt.Sprintf("author-%d", n)
+	postID := fmt.Sprintf("post-%d", n)
+	groupID := fmt.Sprintf("group-%d", n)
+	if tc.author {
+		authorID = viewerID
+	}
+
+	var deletedAt, postGroup interface{}
+	if tc.deleted {
+		deletedAt = 1
+	}
+	if tc.group != "" {
+		postGroup = groupID
+	}
+
+	stmts := []struct {
+		when bool
+		stmt string
+		args []interface{}
+	}{
+		{true, `INSERT INTO users (id, email, password_hash, created_at, updated_at) VALUES (?, ?, 'x', 1, 1)`,
+			[]interface{}{viewerID, viewerID + "@test"}},
+		{!tc.author, `INSERT INTO users (id, email, password_hash, created_at, updated_at) VALUES (?, ?, 'x', 1, 1)`,
+			[]interface{}{authorID, authorID + "@test"}},
+		{tc.group != "", `INSERT INTO groups (id, name, creator_id, created_at, updated_at) VALUES (?, 'g', ?, 1, 1)`,
+			[]interface{}{groupID, authorID}},
+		{tc.group == "member", `INSERT INTO group_members (id, group_id, user_id, role, joined_at) VALUES (?, ?, ?, 'member', 1)`,
+			[]interface{}{groupID + "-member", groupID, viewerID}},
+		{true, `INSERT INTO posts (id, user_id, group_id, content, privacy, created_at, updated_at, deleted_at) VALUES (?, ?, ?, 'c', ?, 1, 1, ?)`,
+			[]interface{}{postID, authorID, postGroup, tc.privacy, deletedAt}},
+		{tc.follows, `INSERT INTO follows (id, follower_id, followed_id, status, created_at) VALUES (?, ?, ?, 'accepted', 1)`,
+			[]interface{}{postID + "-follow", viewerID, authorID}},
+		{tc.allowed, `INSERT INTO post_allowed_users (post_id, user_id) VALUES (?, ?)`,
+			[]interface{}{postID, viewerID}},
+		// Blocks are checked both ways, so record this one from the author's side
+		{tc.blocked, `INSERT INTO blocks (blocker_id, blocked_id, kind, created_at) VALUES (?, ?, 'block', 1)`,
+			[]interface{}{authorID, viewerID}},
+	}
+	for _, s := range stmts {
+		if !s.when {
+			continue
+		}
+		if _, err := db.Exec(s.stmt, s.args...); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+	return viewerID, postID
+}
+
+// TestCanViewImageRevisions checks that images dropped from a post in an edit
+// stay with its author, while the current image follows the post's visibility
+func TestCanViewImageRevisions(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	fixture := []string{
+		`INSERT INTO users (id, email, password_hash, created_at, updated_at) VALUES ('author', 'author@test', 'x', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, created_at, updated_at) VALUES ('follower', 'follower@test', 'x', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, created_at, updated_at) VALUES ('stranger', 'stranger@test', 'x', 1, 1)`,
+		`INSERT INTO follows (id, follower_id, followed_id, status, created_at) VALUES ('f', 'follower', 'author', 'accepted', 1)`,
+		`INSERT INTO posts (id, user_id, content, image_url, privacy, created_at, updated_at) VALUES ('post', 'author', 'now', '/uploads/new.png', 'almost_private', 1, 1)`,
+		`INSERT INTO post_revisions (id, post_id, editor_id, content, image_url, privacy, created_at) VALUES ('rev', 'post', 'author', 'before', '/uploads/old.png', 'private', 1)`,
+		`INSERT INTO media (id, owner_id, kind, mime_type, size, sha256, filename, created_at) VALUES ('m', 'author', 'image', 'image/png', 1, 'x', 'gallery.png', 1)`,
+		`INSERT INTO post_revision_media (revision_id, media_id, position, alt_text) VALUES ('rev', 'm', 0, '')`,
+	}
+	for _, stmt := range fixture {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	check := func(viewerID, url string, want bool) {
+		t.Helper()
+		got, err := CanViewImage(db, ctx, viewerID, url)
+		if err != nil {
+			t.Fatalf("CanViewImage failed: %v", err)
+		}
+		if got != want {
+			t.Errorf("CanViewImage(%s, %s) = %v, want %v", viewerID, url, got, want)
+		}
+	}
+	for _, url := range []string{"/uploads/old.png", "/uploads/gallery.png"} {
+		check("author", url, true)
+		check("follower", url, false)
+		check("stranger", url, false)
+	}
+	check("follower", "/uploads/new.png", true)
+	check("stranger", "/uploads/new.png", false)
+
+	if _, err := db.Exec(`UPDATE posts SET deleted_at = 1 WHERE id = 'post'`); err != nil {
+		t.Fatalf("failed to delete post: %v", err)
+	}
+	check("author", "/uploads/old.png", false)
+}
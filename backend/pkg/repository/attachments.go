@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"social-nework/pkg/models"
+)
+
+// MaxAttachmentsPerMessage limits how many files one message can carry
+const MaxAttachmentsPerMessage = 10
+
+var ErrInvalidAttachment = errors.New("attachment not found or already sent")
+
+// AttachmentURL is where participants download an attachment
+func AttachmentURL(chatID, attachmentID string) string {
+	return fmt.Sprintf("/api/chats/%s/attachments/%s", chatID, attachmentID)
+}
+
+// CreateAttachment records an uploaded file that is not yet part of a message
+func (r *MessageRepository) CreateAttachment(a *models.Attachment) error {
+	a.URL = AttachmentURL(a.ChatID, a.ID)
+	_, err := r.DB.Exec(`
+		INSERT INTO message_attachments
+			(id, chat_id, uploader_id, storage_path, filename, mime_type, size, width, height, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.ChatID, a.UploaderID, a.StoragePath, a.Filename, a.MimeType, a.Size, a.Width, a.Height, a.CreatedAt)
+	return err
+}
+
+// GetAttachment returns an attachment a user may download: it must be in the
+// chat and either sent with a live message or uploaded by the user
+func (r *MessageRepository) GetAttachment(chatID, attachmentID, userID string) (*models.Attachment, error) {
+	rows, err := r.DB.Query(attachmentSelect+`
+		LEFT JOIN messages m ON m.id = a.message_id
+		WHERE a.id = ? AND a.chat_id = ?
+		AND ((a.message_id IS NOT NULL AND m.deleted_at IS NULL) OR (a.message_id IS NULL AND a.uploader_id = ?))`,
+		attachmentID, chatID, userID)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(attachments) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &attachments[0], nil
+}
+
+// attachAttachments fills in Attachments on each message
+func (r *MessageRepository) attachAttachments(messages []models.Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	args := make([]interface{}, len(messages))
+	index := make(map[string]int, len(messages))
+	for i := range messages {
+		args[i] = messages[i].ID
+		index[messages[i].ID] = i
+	}
+	rows, err := r.DB.Query(attachmentSelect+`
+		WHERE a.message_id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(messages)), ", ")+`)
+		ORDER BY a.position ASC`, args...)
+	if err != nil {
+		return err
+	}
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attachments {
+		i := index[*a.MessageID]
+		messages[i].Attachments = append(messages[i].Attachments, a)
+	}
+	return nil
+}
+
+const attachmentSelect = `
+	SELECT a.id, a.chat_id, a.message_id, a.uploader_id, a.storage_path, a.filename,
+	       a.mime_type, a.size, a.width, a.height, a.created_at
+	FROM message_attachments a`
+
+func scanAttachments(rows *sql.Rows) ([]models.Attachment, error) {
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		var a models.Attachment
+		var messageID sql.NullString
+		var width, height sql.NullInt64
+		err := rows.Scan(&a.ID, &a.ChatID, &messageID, &a.UploaderID, &a.StoragePath, &a.Filename,
+			&a.MimeType, &a.Size, &width, &height, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if messageID.Valid {
+			a.MessageID = &messageID.String
+		}
+		if width.Valid && height.Valid {
+			w, h := int(width.Int64), int(height.Int64)
+			a.Width, a.Height = &w, &h
+		}
+		a.URL = AttachmentURL(a.ChatID, a.ID)
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
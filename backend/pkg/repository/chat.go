@@ -381,12 +381,18 @@ func (r *ChatRepository) GetChatType(chatID string) (string, error) {
 	return chatType, err
 }
 
-// CanUsersChat checks if two users can chat based on follow relationship or public profile
+// CanUsersChat checks if two users can chat based on follow relationship or
+// public profile. Users who blocked one another never can.
 func (r *ChatRepository) CanUsersChat(userID1, userID2 string) (bool, error) {
 	// Check if either user follows the other OR if recipient has public profile
 	var canChat bool
 	err := r.DB.QueryRow(`
 		SELECT CASE 
+			WHEN EXISTS (
+				SELECT 1 FROM blocks
+				WHERE kind = 'block'
+				  AND ((blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))
+			) THEN 0
 			WHEN EXISTS (
 				SELECT 1 FROM follows 
 				WHERE (follower_id = ? AND followed_id = ?) 
@@ -402,11 +408,27 @@ func (r *ChatRepository) CanUsersChat(userID1, userID2 string) (bool, error) {
 			) THEN 1
 			ELSE 0
 		END as can_chat`,
+		userID1, userID2, userID2, userID1,
 		userID1, userID2, userID2, userID1, userID1, userID2).Scan(&canChat)
 	
 	return canChat, err
 }
 
+// IsDirectChatBlocked reports whether chatID is a direct chat whose other
+// participant and userID have blocked one another
+func (r *ChatRepository) IsDirectChatBlocked(chatID, userID string) (bool, error) {
+	var blocked bool
+	err := r.DB.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM chats c
+			JOIN chat_participants cp ON cp.chat_id = c.id AND cp.user_id != ?1
+			JOIN blocks b ON b.kind = 'block'
+			  AND ((b.blocker_id = ?1 AND b.blocked_id = cp.user_id) OR (b.blocker_id = cp.user_id AND b.blocked_id = ?1))
+			WHERE c.id = ?2 AND c.type = 'direct'
+		)`, userID, chatID).Scan(&blocked)
+	return blocked, err
+}
+
 // GetChatCount returns the number of chats a user is in
 func (r *ChatRepository) GetChatCount(userID string) (int, error) {
 	var count int
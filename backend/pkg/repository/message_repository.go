@@ -1,11 +1,15 @@
 package repository
 
-import "social-nework/pkg/models"
+import (
+	"database/sql"
+
+	"social-nework/pkg/models"
+)
 
 // GetMessageByID retrieves a message by its ID with sender details
 func (r *MessageRepository) GetMessageByID(messageID string) (*models.Message, error) {
 	query := `
-        SELECT m.id, m.chat_id, m.sender_id, m.content, m.sent_at,
+        SELECT m.id, m.chat_id, m.sender_id, m.content, m.sent_at, m.edited_at,
                u.first_name, u.last_name, u.avatar_url
         FROM messages m
         JOIN users u ON m.sender_id = u.id
@@ -14,6 +18,7 @@ func (r *MessageRepository) GetMessageByID(messageID string) (*models.Message, e
 
 	var message models.Message
 	var sender models.User
+	var editedAt sql.NullInt64
 
 	err := r.DB.QueryRow(query, messageID).Scan(
 		&message.ID,
@@ -21,6 +26,7 @@ func (r *MessageRepository) GetMessageByID(messageID string) (*models.Message, e
 		&message.SenderID,
 		&message.Content,
 		&message.SentAt,
+		&editedAt,
 		&sender.FirstName,
 		&sender.LastName,
 		&sender.AvatarURL,
@@ -31,5 +37,17 @@ func (r *MessageRepository) GetMessageByID(messageID string) (*models.Message, e
 	}
 
 	message.Sender = sender
-	return &message, nil
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Int64
+		message.Edited = true
+	}
+
+	messages := []models.Message{message}
+	if err := r.attachReactions(messages); err != nil {
+		return nil, err
+	}
+	if err := r.attachAttachments(messages); err != nil {
+		return nil, err
+	}
+	return &messages[0], nil
 }
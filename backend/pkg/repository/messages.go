@@ -2,8 +2,9 @@ package repository
 
 import (
 	"database/sql"
-	"fmt"
+	"errors"
 	"log"
+	"strings"
 	"time"
 
 	"social-nework/pkg/models"
@@ -15,20 +16,68 @@ type MessageRepository struct {
 	DB *sql.DB
 }
 
+var (
+	ErrMessageNotFound  = errors.New("message not found")
+	ErrNotMessageSender = errors.New("unauthorized: user is not the sender of this message")
+	ErrEmptyMessage     = errors.New("message content is required")
+)
+
 // SaveMessage saves a message to the database
 func (r *MessageRepository) SaveMessage(msg *models.Message) error {
-	_, err := r.DB.Exec(`
+	return r.SaveMessageWithAttachments(msg, nil)
+}
+
+// SaveMessageWithAttachments saves a message and links attachments the sender
+// uploaded to the same chat and has not sent yet. The message needs content,
+// attachments or both.
+func (r *MessageRepository) SaveMessageWithAttachments(msg *models.Message, attachmentIDs []string) error {
+	if strings.TrimSpace(msg.Content) == "" && len(attachmentIDs) == 0 {
+		return ErrEmptyMessage
+	}
+	if len(attachmentIDs) > MaxAttachmentsPerMessage {
+		return ErrInvalidAttachment
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
 		INSERT INTO messages (id, chat_id, sender_id, content, sent_at)
 		VALUES (?, ?, ?, ?, ?)`,
 		msg.ID, msg.ChatID, msg.SenderID, msg.Content, msg.SentAt)
-	return err
+	if err != nil {
+		return err
+	}
+
+	for i, attachmentID := range attachmentIDs {
+		result, err := tx.Exec(`
+			UPDATE message_attachments SET message_id = ?, position = ?
+			WHERE id = ? AND chat_id = ? AND uploader_id = ? AND message_id IS NULL`,
+			msg.ID, i, attachmentID, msg.ChatID, msg.SenderID)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrInvalidAttachment
+		}
+	}
+
+	return tx.Commit()
 }
 
 // GetChatMessages retrieves messages for a chat with pagination
 func (r *MessageRepository) GetChatMessages(chatID string, before time.Time, limit int) ([]models.Message, error) {
 	query := `
-		SELECT m.id, m.chat_id, m.sender_id, m.content, m.sent_at, m.read_at,
-			   u.first_name, u.last_name, u.avatar_url
+		SELECT m.id, m.chat_id, m.sender_id, m.content, m.sent_at, m.read_at, m.edited_at,
+			   u.first_name, u.last_name, u.avatar_url,
+			   (SELECT GROUP_CONCAT(cp.user_id) FROM chat_participants cp
+			    JOIN messages r ON r.id = cp.last_read_message_id
+			    WHERE cp.chat_id = m.chat_id AND cp.deleted_at IS NULL
+			    AND cp.user_id != m.sender_id
+			    AND (r.sent_at, r.rowid) >= (m.sent_at, m.rowid)) AS read_by
 		FROM messages m
 		JOIN users u ON m.sender_id = u.id
 		WHERE m.chat_id = ? AND m.deleted_at IS NULL`
@@ -40,7 +89,7 @@ func (r *MessageRepository) GetChatMessages(chatID string, before time.Time, lim
 		args = append(args, before)
 	}
 
-	query += " ORDER BY m.sent_at DESC LIMIT ?"
+	query += " ORDER BY m.sent_at DESC, m.rowid DESC LIMIT ?"
 	args = append(args, limit)
 
 	rows, err := r.DB.Query(query, args...)
@@ -53,11 +102,12 @@ func (r *MessageRepository) GetChatMessages(chatID string, before time.Time, lim
 	for rows.Next() {
 		var msg models.Message
 		var sender models.User
-		var readAt sql.NullInt64
+		var readAt, editedAt sql.NullInt64
+		var readBy sql.NullString
 
 		err := rows.Scan(
-			&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Content, &msg.SentAt, &readAt,
-			&sender.FirstName, &sender.LastName, &sender.AvatarURL,
+			&msg.ID, &msg.ChatID, &msg.SenderID, &msg.Content, &msg.SentAt, &readAt, &editedAt,
+			&sender.FirstName, &sender.LastName, &sender.AvatarURL, &readBy,
 		)
 		if err != nil {
 			return nil, err
@@ -67,10 +117,26 @@ func (r *MessageRepository) GetChatMessages(chatID string, before time.Time, lim
 		if readAt.Valid {
 			msg.ReadAt = &readAt.Int64
 		}
+		if editedAt.Valid {
+			msg.EditedAt = &editedAt.Int64
+			msg.Edited = true
+		}
+		if readBy.Valid {
+			msg.ReadBy = strings.Split(readBy.String, ",")
+		}
 
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
+	if err := r.attachReactions(messages); err != nil {
+		return nil, err
+	}
+	if err := r.attachAttachments(messages); err != nil {
+		return nil, err
+	}
 	return messages, nil
 }
 
@@ -136,50 +202,262 @@ func (r *MessageRepository) CreateDirectChat(user1, user2 string) (string, error
 	return chatID, tx.Commit()
 }
 
-// MarkMessageAsRead marks a message as read by a user
+// MarkMessageAsRead marks a message, and everything before it in its chat, as read by a user
 func (r *MessageRepository) MarkMessageAsRead(messageID, userID string) error {
-	_, err := r.DB.Exec(`
-		UPDATE messages 
-		SET read_at = ? 
-		WHERE id = ? AND read_at IS NULL`,
-		time.Now(), messageID)
+	var chatID string
+	err := r.DB.QueryRow(`SELECT chat_id FROM messages WHERE id = ?`, messageID).Scan(&chatID)
+	if err != nil {
+		return err
+	}
+	_, _, err = r.MarkChatRead(chatID, userID, messageID)
 	return err
 }
 
-// GetUnreadMessageCount returns the count of unread messages for a user in a chat
+// MarkChatRead moves the user's read pointer in a chat up to the given message,
+// or to the latest message when messageID is empty. The pointer never moves
+// backwards; advanced reports whether it moved. sql.ErrNoRows is returned when
+// the message is not in the chat or the chat has no messages.
+func (r *MessageRepository) MarkChatRead(chatID, userID, messageID string) (receipt *models.ReadReceipt, advanced bool, err error) {
+	if messageID == "" {
+		err = r.DB.QueryRow(`
+			SELECT id FROM messages
+			WHERE chat_id = ? AND deleted_at IS NULL
+			ORDER BY sent_at DESC, rowid DESC LIMIT 1`, chatID).Scan(&messageID)
+	} else {
+		err = r.DB.QueryRow(`
+			SELECT id FROM messages
+			WHERE id = ? AND chat_id = ? AND deleted_at IS NULL`, messageID, chatID).Scan(&messageID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := time.Now().Unix()
+	result, err := r.DB.Exec(`
+		UPDATE chat_participants
+		SET last_read_message_id = ?, last_read_at = ?
+		WHERE chat_id = ? AND user_id = ? AND deleted_at IS NULL
+		AND (last_read_message_id IS NULL OR
+			(SELECT sent_at, rowid FROM messages WHERE id = ?) >
+			(SELECT sent_at, rowid FROM messages WHERE id = last_read_message_id))`,
+		messageID, now, chatID, userID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+	rowsAffected, _ := result.RowsAffected()
+
+	receipt = &models.ReadReceipt{ChatID: chatID, UserID: userID, MessageID: messageID, ReadAt: now}
+	if rowsAffected == 0 {
+		// Already read this far; report the existing pointer
+		var readAt sql.NullInt64
+		err = r.DB.QueryRow(`
+			SELECT last_read_message_id, last_read_at FROM chat_participants
+			WHERE chat_id = ? AND user_id = ? AND deleted_at IS NULL`, chatID, userID).Scan(&receipt.MessageID, &readAt)
+		if err != nil {
+			return nil, false, err
+		}
+		receipt.ReadAt = readAt.Int64
+	}
+	return receipt, rowsAffected > 0, nil
+}
+
+// GetUnreadMessageCount returns the count of messages from others after the user's read pointer
 func (r *MessageRepository) GetUnreadMessageCount(chatID, userID string) (int, error) {
 	var count int
 	err := r.DB.QueryRow(`
-		SELECT COUNT(*) 
+		SELECT COUNT(*)
 		FROM messages m
-		WHERE m.chat_id = ? AND m.sender_id != ? 
-		AND m.read_at IS NULL AND m.deleted_at IS NULL`,
-		chatID, userID).Scan(&count)
+		JOIN chat_participants cp ON cp.chat_id = m.chat_id AND cp.user_id = ? AND cp.deleted_at IS NULL
+		LEFT JOIN messages r ON r.id = cp.last_read_message_id
+		WHERE m.chat_id = ? AND m.sender_id != ? AND m.deleted_at IS NULL
+		AND (r.id IS NULL OR (m.sent_at, m.rowid) > (r.sent_at, r.rowid))`,
+		userID, chatID, userID).Scan(&count)
 	return count, err
 }
 
-// DeleteMessage soft deletes a message
-func (r *MessageRepository) DeleteMessage(messageID, userID string) error {
-	// Check if user is the sender
-	var senderID string
-	err := r.DB.QueryRow(`
-		SELECT sender_id FROM messages WHERE id = ?`, messageID).Scan(&senderID)
+// GetReadReceipts returns every participant's read pointer in a chat
+func (r *MessageRepository) GetReadReceipts(chatID string) ([]models.ReadReceipt, error) {
+	rows, err := r.DB.Query(`
+		SELECT user_id, last_read_message_id, COALESCE(last_read_at, 0)
+		FROM chat_participants
+		WHERE chat_id = ? AND deleted_at IS NULL AND last_read_message_id IS NOT NULL`, chatID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if senderID != userID {
-		return fmt.Errorf("unauthorized: user is not the sender of this message")
+	receipts := []models.ReadReceipt{}
+	for rows.Next() {
+		receipt := models.ReadReceipt{ChatID: chatID}
+		if err := rows.Scan(&receipt.UserID, &receipt.MessageID, &receipt.ReadAt); err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
 	}
+	return receipts, rows.Err()
+}
 
-	_, err = r.DB.Exec(`
+// DeleteMessage soft deletes a message; only its sender may delete it
+func (r *MessageRepository) DeleteMessage(messageID, userID string) error {
+	if err := r.checkSender(messageID, userID); err != nil {
+		return err
+	}
+
+	_, err := r.DB.Exec(`
 		UPDATE messages 
 		SET deleted_at = ? 
 		WHERE id = ?`,
-		time.Now(), messageID)
+		time.Now().Unix(), messageID)
 	return err
 }
 
+// EditMessage replaces a message's content, keeping the old content as a revision.
+// Only the sender may edit.
+func (r *MessageRepository) EditMessage(messageID, userID, content string) error {
+	if strings.TrimSpace(content) == "" {
+		return ErrEmptyMessage
+	}
+	if err := r.checkSender(messageID, userID); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(`
+		INSERT INTO message_revisions (id, message_id, content, created_at)
+		SELECT ?, id, content, ? FROM messages WHERE id = ?`,
+		uuid.New().String(), now, messageID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE messages SET content = ?, edited_at = ?
+		WHERE id = ? AND deleted_at IS NULL`,
+		content, now, messageID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetMessageRevisions returns the previous contents of a message, oldest first
+func (r *MessageRepository) GetMessageRevisions(messageID string) ([]models.MessageRevision, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, message_id, content, created_at
+		FROM message_revisions
+		WHERE message_id = ?
+		ORDER BY created_at ASC, rowid ASC`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.MessageRevision{}
+	for rows.Next() {
+		var rev models.MessageRevision
+		if err := rows.Scan(&rev.ID, &rev.MessageID, &rev.Content, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// SetMessageReaction sets the user's reaction on a message, replacing any
+// previous one; an empty reaction removes it
+func (r *MessageRepository) SetMessageReaction(messageID, userID, reaction string) error {
+	if reaction == "" {
+		_, err := r.DB.Exec(`
+			DELETE FROM message_reactions WHERE message_id = ? AND user_id = ?`,
+			messageID, userID)
+		return err
+	}
+	if !models.IsValidReaction(reaction) {
+		return models.ErrInvalidReaction
+	}
+
+	_, err := r.DB.Exec(`
+		INSERT INTO message_reactions (message_id, user_id, reaction, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id, user_id) DO UPDATE SET reaction = excluded.reaction, created_at = excluded.created_at`,
+		messageID, userID, reaction, time.Now().Unix())
+	return err
+}
+
+// GetMessageReactions returns, for each message, the users who chose each reaction
+func (r *MessageRepository) GetMessageReactions(messageIDs []string) (map[string]map[string][]string, error) {
+	reactions := make(map[string]map[string][]string)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := r.DB.Query(`
+		SELECT message_id, reaction, user_id
+		FROM message_reactions
+		WHERE message_id IN (`+strings.TrimSuffix(strings.Repeat("?, ", len(messageIDs)), ", ")+`)
+		ORDER BY created_at ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID, reaction, userID string
+		if err := rows.Scan(&messageID, &reaction, &userID); err != nil {
+			return nil, err
+		}
+		if reactions[messageID] == nil {
+			reactions[messageID] = make(map[string][]string)
+		}
+		reactions[messageID][reaction] = append(reactions[messageID][reaction], userID)
+	}
+	return reactions, rows.Err()
+}
+
+// attachReactions fills in Reactions on each message
+func (r *MessageRepository) attachReactions(messages []models.Message) error {
+	ids := make([]string, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].ID
+	}
+	reactions, err := r.GetMessageReactions(ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+	return nil
+}
+
+// checkSender returns ErrMessageNotFound or ErrNotMessageSender unless the user sent the live message
+func (r *MessageRepository) checkSender(messageID, userID string) error {
+	var senderID string
+	err := r.DB.QueryRow(`
+		SELECT sender_id FROM messages WHERE id = ? AND deleted_at IS NULL`, messageID).Scan(&senderID)
+	if err == sql.ErrNoRows {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if senderID != userID {
+		return ErrNotMessageSender
+	}
+	return nil
+}
+
 // GetLastMessageForChat returns the last message in a chat
 func (r *MessageRepository) GetLastMessageForChat(chatID string) (*models.Message, error) {
 	messages, err := r.GetChatMessages(chatID, time.Time{}, 1)
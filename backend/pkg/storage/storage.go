@@ -0,0 +1,65 @@
+// Package storage keeps uploaded files: media, avatars, post and comment
+// images and chat attachments. Backend is implemented by Local, a directory on
+// disk, and S3, any S3-compatible object store.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrInvalidKey = errors.New("storage: invalid key")
+)
+
+// MaxURLExpiry is the longest a signed URL can stay valid, as on S3
+const MaxURLExpiry = 7 * 24 * time.Hour
+
+// Object describes a stored file
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string // Empty if the backend does not keep it
+	ModTime     time.Time
+}
+
+// URLOptions set headers of the response to a signed URL
+type URLOptions struct {
+	ContentType        string
+	ContentDisposition string
+}
+
+// Backend stores files under keys: slash-separated relative paths such as
+// "attachments/<id>.pdf"
+type Backend interface {
+	// Put stores size bytes read from body under key, replacing any file there
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Get opens the file stored under key; the caller closes it
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *Object, error)
+	Stat(ctx context.Context, key string) (*Object, error)
+	// Delete removes the file under key; deleting a missing file is not an error
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL serving the file without credentials until expires
+	SignedURL(ctx context.Context, key string, expires time.Duration, opts URLOptions) (string, error)
+}
+
+// checkKey rejects keys that are empty, absolute or leave the storage root
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") || strings.Contains(key, "\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+func checkExpiry(expires time.Duration) error {
+	if expires <= 0 || expires > MaxURLExpiry {
+		return fmt.Errorf("storage: signed URL expiry must be between 0 and %v", MaxURLExpiry)
+	}
+	return nil
+}
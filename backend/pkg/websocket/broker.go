@@ -0,0 +1,104 @@
+package websocket
+
+import "log"
+
+// Broker carries hub events between backend processes, so a user connected to
+// one process gets the chat messages, notifications and presence raised in
+// another. The hub delivers to its own clients itself and publishes every
+// event so the other processes can deliver to theirs.
+type Broker interface {
+	// Publish hands an event to every other process
+	Publish(event BrokerEvent) error
+	// Subscribe starts calling handler with the events other processes publish.
+	// It is called once, before Run.
+	Subscribe(handler func(BrokerEvent)) error
+	// Close stops delivering events
+	Close() error
+}
+
+// BrokerEvent is a payload and the users it is for
+type BrokerEvent struct {
+	Recipients []string         `json:"recipients"`
+	Ephemeral  bool             `json:"ephemeral,omitempty"` // Only for connected users; not kept for resume
+	Presence   *PresenceData    `json:"presence,omitempty"`  // Set for presence changes so every process tracks them
+	Sessions   *RevokedSessions `json:"sessions,omitempty"`  // Set alone, without a payload, to close revoked sessions' connections
+	Payload    MessagePayload   `json:"payload"`
+
+	// Origin identifies the process that published the event. Brokers set it
+	// on the events they deliver; it is empty on events raised here.
+	Origin string `json:"-"`
+}
+
+// localBroker is the broker of a single process: there is no one to publish to
+type localBroker struct{}
+
+// NewLocalBroker returns a broker for running one backend process
+func NewLocalBroker() Broker {
+	return localBroker{}
+}
+
+func (localBroker) Publish(BrokerEvent) error                 { return nil }
+func (localBroker) Subscribe(handler func(BrokerEvent)) error { return nil }
+func (localBroker) Close() error                              { return nil }
+
+// fanout delivers a payload to the recipients connected to this process and
+// publishes it for the rest. The caller must hold h.mu.
+func (h *Hub) fanout(event BrokerEvent) {
+	h.dispatch(event)
+	if err := h.broker.Publish(event); err != nil {
+		log.Printf("ERROR: Failed to publish %s to other processes: %v", event.Payload.Type, err)
+	}
+}
+
+// dispatch delivers an event to this process's clients. Durable events are also
+// kept for recipients who are not connected here so they can resume from this
+// process. The caller must hold h.mu.
+func (h *Hub) dispatch(event BrokerEvent) {
+	for _, userID := range event.Recipients {
+		if _, connected := h.Clients[userID]; event.Ephemeral && !connected {
+			continue
+		}
+		h.deliver(userID, event.Payload)
+	}
+}
+
+// receive queues an event from another process for Run
+func (h *Hub) receive(event BrokerEvent) {
+	select {
+	case h.remote <- event:
+	case <-h.quit:
+	}
+}
+
+// handleRemote delivers an event published by another process and tracks the
+// presence of users connected there. A presence change only reports the
+// user's connections on the publishing process, so contacts here are told the
+// status combined with every other process instead. The caller must hold h.mu
+// for writing.
+func (h *Hub) handleRemote(event BrokerEvent) {
+	if event.Sessions != nil {
+		h.closeSessions(*event.Sessions)
+		return
+	}
+
+	p := event.Presence
+	if p == nil {
+		h.dispatch(event)
+		return
+	}
+
+	processes := h.remotePresence[p.UserID]
+	if p.Status == StatusOffline {
+		delete(processes, event.Origin)
+		if len(processes) == 0 {
+			delete(h.remotePresence, p.UserID)
+		}
+	} else {
+		if processes == nil {
+			processes = make(map[string]PresenceData)
+			h.remotePresence[p.UserID] = processes
+		}
+		processes[event.Origin] = *p
+	}
+	h.announcePresence(*p, event.Recipients)
+}
@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// sqliteBrokerPollInterval is how often a process looks for events from the others
+	sqliteBrokerPollInterval = 100 * time.Millisecond
+	// sqliteBrokerRetention is how long published events stay in hub_events
+	sqliteBrokerRetention = time.Minute
+)
+
+// SQLiteBroker hands events between backend processes sharing one SQLite
+// database. Each process appends what it publishes to hub_events and polls
+// for rows appended by the others.
+type SQLiteBroker struct {
+	db     *sql.DB
+	origin string // Tells this process's rows apart from the others'
+
+	started   bool
+	quit      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSQLiteBroker returns a broker using the hub_events table of db
+func NewSQLiteBroker(db *sql.DB) *SQLiteBroker {
+	return &SQLiteBroker{
+		db:     db,
+		origin: uuid.New().String(),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Publish appends an event for the other processes to pick up
+func (b *SQLiteBroker) Publish(event BrokerEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Exec(`INSERT INTO hub_events (origin, body, created_at) VALUES (?, ?, ?)`,
+		b.origin, body, time.Now().Unix())
+	return err
+}
+
+// Subscribe polls for events published after now by the other processes
+func (b *SQLiteBroker) Subscribe(handler func(BrokerEvent)) error {
+	var lastID int64
+	if err := b.db.QueryRow(`SELECT COALESCE(MAX(id), 0) FROM hub_events`).Scan(&lastID); err != nil {
+		return err
+	}
+
+	b.started = true
+	go func() {
+		defer close(b.done)
+		ticker := time.NewTicker(sqliteBrokerPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.quit:
+				return
+			case <-ticker.C:
+				lastID = b.poll(lastID, handler)
+			}
+		}
+	}()
+	return nil
+}
+
+// poll hands every event after lastID from another process to handler and
+// returns the last ID seen. It also prunes events nobody needs any more.
+func (b *SQLiteBroker) poll(lastID int64, handler func(BrokerEvent)) int64 {
+	rows, err := b.db.Query(`
+		SELECT id, origin, body FROM hub_events
+		WHERE id > ? ORDER BY id`, lastID)
+	if err != nil {
+		log.Printf("SQLiteBroker: Failed to poll events: %v", err)
+		return lastID
+	}
+
+	var events []BrokerEvent
+	for rows.Next() {
+		var origin string
+		var body []byte
+		if err := rows.Scan(&lastID, &origin, &body); err != nil {
+			log.Printf("SQLiteBroker: Failed to read event: %v", err)
+			break
+		}
+		if origin == b.origin {
+			continue
+		}
+		var event BrokerEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			log.Printf("SQLiteBroker: Skipping malformed event %d: %v", lastID, err)
+			continue
+		}
+		event.Origin = origin
+		events = append(events, event)
+	}
+	rows.Close()
+
+	// Handle after closing rows so handler may use the database
+	for _, event := range events {
+		handler(event)
+	}
+
+	cutoff := time.Now().Add(-sqliteBrokerRetention).Unix()
+	if _, err := b.db.Exec(`DELETE FROM hub_events WHERE created_at < ?`, cutoff); err != nil {
+		log.Printf("SQLiteBroker: Failed to prune events: %v", err)
+	}
+	return lastID
+}
+
+// Close stops polling and waits for the poller to return
+func (b *SQLiteBroker) Close() error {
+	b.closeOnce.Do(func() { close(b.quit) })
+	if b.started {
+		<-b.done
+	}
+	return nil
+}
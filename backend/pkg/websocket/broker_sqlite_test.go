@@ -0,0 +1,286 @@
+package websocket
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"social-nework/pkg/db/sqlite"
+	"social-nework/pkg/models"
+	"social-nework/pkg/repository"
+)
+
+// startHub runs a hub with its own connection and SQLiteBroker on the database
+// at path, as a separate backend process would
+func startHub(t *testing.T, path string) *Hub {
+	t.Helper()
+	db, err := sqlite.NewDB(path, "../db/migrations/sqlite")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	broker := NewSQLiteBroker(db)
+	hub := NewHub(db, &repository.MessageRepository{DB: db}, &repository.ChatRepository{DB: db}, broker)
+	go hub.Run()
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := hub.Shutdown(ctx); err != nil {
+			t.Errorf("hub shutdown: %v", err)
+		}
+		broker.Close()
+		db.Close()
+	})
+	return hub
+}
+
+// connect registers a client without a network connection; its Send channel
+// is read by the test instead of a writePump
+func connect(t *testing.T, hub *Hub, userID string) *Client {
+	t.Helper()
+	return connectSession(t, hub, userID, "")
+}
+
+// connectSession is connect for a client opened under a login session
+func connectSession(t *testing.T, hub *Hub, userID, sessionID string) *Client {
+	t.Helper()
+	client := &Client{
+		Hub:       hub,
+		Send:      make(chan MessagePayload, 256),
+		UserID:    userID,
+		Chats:     make(map[string]bool),
+		SessionID: sessionID,
+		closing:   make(chan []byte, 1),
+		frames:    newTokenBucket(hub.limits.FrameRate, hub.limits.FrameBurst),
+	}
+	hub.Register <- client
+	receive(client, 2*time.Second, func(got []MessagePayload) bool { return count(got, "hello", "") > 0 })
+	return client
+}
+
+// receive reads what was queued for client until done reports true for
+// everything read so far or timeout passes
+func receive(client *Client, timeout time.Duration, done func([]MessagePayload) bool) []MessagePayload {
+	var got []MessagePayload
+	deadline := time.After(timeout)
+	for done == nil || !done(got) {
+		select {
+		case payload := <-client.Send:
+			got = append(got, payload)
+		case <-deadline:
+			return got
+		}
+	}
+	return got
+}
+
+// count returns how many payloads have type typ and, unless empty, come from senderID
+func count(payloads []MessagePayload, typ, senderID string) int {
+	n := 0
+	for _, p := range payloads {
+		if p.Type == typ && (senderID == "" || p.SenderID == senderID) {
+			n++
+		}
+	}
+	return n
+}
+
+// TestSQLiteBrokerDeliversAcrossHubs checks that a chat message, a notification
+// and a presence change raised on one hub reach a client registered on another
+// hub sharing the database, and that no hub gets its own events back
+func TestSQLiteBrokerDeliversAcrossHubs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	hubA := startHub(t, path)
+	hubB := startHub(t, path)
+
+	fixture := []string{
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('alice', 'alice@test', 'x', 'alice', 'test', 'alice', '', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('bob', 'bob@test', 'x', 'bob', 'test', 'bob', '', 1, 1)`,
+		`INSERT INTO chats (id, type, created_at) VALUES ('chat', 'direct', 1)`,
+		`INSERT INTO chat_participants (id, chat_id, user_id, joined_at) VALUES ('p1', 'chat', 'alice', 1)`,
+		`INSERT INTO chat_participants (id, chat_id, user_id, joined_at) VALUES ('p2', 'chat', 'bob', 1)`,
+	}
+	for _, stmt := range fixture {
+		if _, err := hubA.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	// Bob is connected to both processes; his connection to A shows whether A
+	// also delivers its own events a second time through the broker
+	bobOnB := connect(t, hubB, "bob")
+	bobOnA := connect(t, hubA, "bob")
+	receive(bobOnB, 500*time.Millisecond, nil) // Bob's own presence on A
+	alice := connect(t, hubA, "alice")
+
+	hubA.MessageQueue <- MessagePayload{
+		ID:       "m1",
+		Type:     "message",
+		ChatID:   "chat",
+		SenderID: "alice",
+		Content:  "hello",
+		Data:     &SendMessageData{},
+		client:   alice,
+	}
+	hubA.SendNotification("bob", models.Notification{
+		ID:          "n1",
+		UserID:      "bob",
+		Type:        "new_follower",
+		ReferenceID: "alice",
+		CreatedAt:   time.Now(),
+	}, nil)
+
+	got := receive(bobOnB, 5*time.Second, func(got []MessagePayload) bool {
+		return count(got, "presence", "alice") > 0 && count(got, "new_message", "") > 0 && count(got, "notification", "") > 0
+	})
+	for _, typ := range []string{"presence", "new_message", "notification"} {
+		if n := count(got, typ, ""); n != 1 {
+			t.Errorf("bob on hub B got %d %s events, want 1", n, typ)
+		}
+	}
+
+	hubB.mu.RLock()
+	presence := hubB.presenceOf("alice")
+	hubB.mu.RUnlock()
+	if presence.Status != StatusOnline {
+		t.Errorf("hub B tracks alice as %+v, want online", presence)
+	}
+
+	// Leave the poller several rounds to echo anything back
+	time.Sleep(5 * sqliteBrokerPollInterval)
+	got = receive(bobOnA, 100*time.Millisecond, nil)
+	if n := count(got, "presence", "alice"); n != 1 {
+		t.Errorf("bob on hub A got %d presence events from alice, want 1", n)
+	}
+	for _, typ := range []string{"new_message", "notification"} {
+		if n := count(got, typ, ""); n != 1 {
+			t.Errorf("bob on hub A got %d %s events, want 1", n, typ)
+		}
+	}
+	if n := count(receive(alice, 100*time.Millisecond, nil), "new_message", ""); n != 1 {
+		t.Errorf("alice got her message %d times, want 1", n)
+	}
+}
+
+// TestSQLiteBrokerKeepsUserOnlineOnAnotherHub checks that a user connected to
+// two hubs stays online for contacts on either hub when one connection closes,
+// and only goes offline once both have
+func TestSQLiteBrokerKeepsUserOnlineOnAnotherHub(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	hubA := startHub(t, path)
+	hubB := startHub(t, path)
+
+	fixture := []string{
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('alice', 'alice@test', 'x', 'alice', 'test', 'alice', '', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('bob', 'bob@test', 'x', 'bob', 'test', 'bob', '', 1, 1)`,
+		`INSERT INTO follows (id, follower_id, followed_id, status, created_at) VALUES ('f1', 'bob', 'alice', 'accepted', 1)`,
+	}
+	for _, stmt := range fixture {
+		if _, err := hubA.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	bob := connect(t, hubB, "bob")
+	aliceOnA := connect(t, hubA, "alice")
+	aliceOnB := connect(t, hubB, "alice")
+	online := func(got []MessagePayload) bool { return count(got, "presence", "alice") > 0 }
+	if got := receive(bob, 2*time.Second, online); count(got, "presence", "alice") != 1 {
+		t.Fatalf("bob got %d presence events from alice, want 1", count(got, "presence", "alice"))
+	}
+
+	isOnline := func(hub *Hub) bool {
+		time.Sleep(5 * sqliteBrokerPollInterval)
+		return hub.IsUserOnline("alice")
+	}
+
+	// Closing either connection leaves her online everywhere
+	hubA.Unregister <- aliceOnA
+	if !isOnline(hubB) {
+		t.Errorf("hub B reports alice offline while she is connected to it")
+	}
+	if got := receive(bob, 100*time.Millisecond, nil); count(got, "presence", "alice") != 0 {
+		t.Errorf("bob was told alice's presence changed while she stayed online: %+v", got)
+	}
+
+	aliceOnA = connect(t, hubA, "alice")
+	time.Sleep(5 * sqliteBrokerPollInterval) // Until hub B learns she is back on A
+	hubB.Unregister <- aliceOnB
+	if !isOnline(hubA) || !isOnline(hubB) {
+		t.Errorf("alice is offline on a hub while still connected to hub A")
+	}
+	if got := receive(bob, 100*time.Millisecond, nil); count(got, "presence", "alice") != 0 {
+		t.Errorf("bob was told alice's presence changed while she stayed online: %+v", got)
+	}
+
+	hubA.Unregister <- aliceOnA
+	got := receive(bob, 2*time.Second, online)
+	if count(got, "presence", "alice") != 1 || got[len(got)-1].Data.(PresenceData).Status != StatusOffline {
+		t.Errorf("bob got %+v once alice left both hubs, want one offline presence", got)
+	}
+	if isOnline(hubA) || isOnline(hubB) {
+		t.Errorf("alice is still online after leaving both hubs")
+	}
+}
+
+// TestSQLiteBrokerCombinesStatusAcrossHubs checks that a user is away only once
+// their connections on every hub are, and that closing the last connection on
+// one hub leaves the status from the other
+func TestSQLiteBrokerCombinesStatusAcrossHubs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	hubA := startHub(t, path)
+	hubB := startHub(t, path)
+
+	fixture := []string{
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('alice', 'alice@test', 'x', 'alice', 'test', 'alice', '', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('bob', 'bob@test', 'x', 'bob', 'test', 'bob', '', 1, 1)`,
+		`INSERT INTO follows (id, follower_id, followed_id, status, created_at) VALUES ('f1', 'bob', 'alice', 'accepted', 1)`,
+	}
+	for _, stmt := range fixture {
+		if _, err := hubA.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	bob := connect(t, hubB, "bob")
+	aliceOnA := connect(t, hubA, "alice")
+	aliceOnB := connect(t, hubB, "alice")
+	presence := func(got []MessagePayload) bool { return count(got, "presence", "alice") > 0 }
+	receive(bob, 2*time.Second, presence)
+	time.Sleep(5 * sqliteBrokerPollInterval)
+
+	// The presence snapshot of a new connection shows the status a hub has for alice
+	status := func(hub *Hub) string {
+		observer := connect(t, hub, "bob")
+		defer func() { hub.Unregister <- observer }()
+		got := receive(observer, 500*time.Millisecond, presence)
+		if count(got, "presence", "alice") == 0 {
+			return StatusOffline
+		}
+		return got[len(got)-1].Data.(PresenceData).Status
+	}
+
+	// Away on B, still online on A
+	hubB.MessageQueue <- MessagePayload{Type: "presence", SenderID: "alice", Data: &PresenceRequestData{Status: StatusAway}, client: aliceOnB}
+	time.Sleep(5 * sqliteBrokerPollInterval)
+	if got := status(hubB); got != StatusOnline {
+		t.Errorf("hub B reports alice %s while she is online on hub A", got)
+	}
+	if got := receive(bob, 100*time.Millisecond, nil); count(got, "presence", "alice") != 0 {
+		t.Errorf("bob was told alice's presence changed while she stayed online: %+v", got)
+	}
+
+	// Leaving A leaves the away connection on B
+	hubA.Unregister <- aliceOnA
+	got := receive(bob, 2*time.Second, presence)
+	if count(got, "presence", "alice") != 1 || got[len(got)-1].Data.(PresenceData).Status != StatusAway {
+		t.Errorf("bob got %+v once alice left hub A, want one away presence", got)
+	}
+	time.Sleep(5 * sqliteBrokerPollInterval)
+	for name, hub := range map[string]*Hub{"A": hubA, "B": hubB} {
+		if got := status(hub); got != StatusAway {
+			t.Errorf("hub %s reports alice %s, want away", name, got)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,14 +23,51 @@ type Client struct {
 	UserID string
 	Chats  map[string]bool
 	mu     sync.RWMutex
+
+	// Login session the connection was opened under; see CloseSessions
+	SessionID string
+
+	// Presence, only touched by Hub.Run
+	Status     string
+	LastSeenAt int64
+
+	// Resume request from the /ws query (?last_seq=&epoch=); nil for a fresh connection
+	resumeSeq   *uint64
+	resumeEpoch string
+
+	// Close frame for writePump to send once it has flushed Send
+	closing chan []byte
+
+	// Rate limiting, only touched by readPump
+	frames         *tokenBucket
+	throttled      int // Frames throttled since throttledSince
+	throttledSince time.Time
+}
+
+// SetAllowedOrigins sets the origins whose pages may open connections; "*"
+// allows any. Pages served by this host are always allowed. Call it before
+// serving connections.
+func (h *Hub) SetAllowedOrigins(origins []string) {
+	h.origins = origins
 }
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for simplicity; adjust as needed
-	},
+// checkOrigin stops pages on other sites from opening a connection with the
+// user's cookie. Requests without an Origin header don't come from a browser.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range h.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	log.Printf("WebSocket: Rejected connection from origin %q", origin)
+	return false
 }
 
 const (
@@ -46,8 +86,18 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	sessionID, _ := r.Context().Value("session_id").(string)
+
 	log.Printf("WebSocket: User %s attempting to connect", userID)
 
+	// Refuse new connections once the hub is shutting down
+	select {
+	case <-hub.quit:
+		http.Error(w, "Server shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
 	// Fetch user chat IDs from the repository
 	chatIDs, err := hub.chatRepo.GetUserChatIDs(userID)
 	if err != nil {
@@ -58,7 +108,18 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("WebSocket: User %s has chat IDs: %v", userID, chatIDs)
 
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// A reconnecting client passes the last sequence number it saw to get what it missed
+	var resumeSeq *uint64
+	if v := r.URL.Query().Get("last_seq"); v != "" {
+		seq, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid last_seq", http.StatusBadRequest)
+			return
+		}
+		resumeSeq = &seq
+	}
+
+	conn, err := hub.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("WebSocket upgrade error:", err)
 		return
@@ -70,6 +131,13 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 		Send:   make(chan MessagePayload, 256),
 		UserID: userID,
 		Chats:  make(map[string]bool),
+
+		SessionID: sessionID,
+
+		resumeSeq:   resumeSeq,
+		resumeEpoch: r.URL.Query().Get("epoch"),
+		closing:     make(chan []byte, 1),
+		frames:      newTokenBucket(hub.limits.FrameRate, hub.limits.FrameBurst),
 	}
 
 	for _, chatID := range chatIDs {
@@ -78,7 +146,19 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("WebSocket: Registering client %s", userID)
-	hub.Register <- client
+
+	// Count the writePump before Run can see the client, so Shutdown waits for
+	// it, and give up if Run has already stopped reading Register
+	hub.pumps.Add(1)
+	select {
+	case hub.Register <- client:
+	case <-hub.quit:
+		hub.pumps.Done()
+		closeFrame := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server going away")
+		conn.WriteControl(websocket.CloseMessage, closeFrame, time.Now().Add(writeWait))
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -86,10 +166,14 @@ func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
 
 func (c *Client) readPump() {
 	defer func() {
-		c.Hub.Unregister <- c
+		select {
+		case c.Hub.Unregister <- c:
+		case <-c.Hub.quit:
+		}
 		c.Conn.Close()
 	}()
 
+	c.Conn.SetReadLimit(int64(c.Hub.limits.MaxFrameBytes))
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
@@ -97,17 +181,91 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		var msg MessagePayload
-		err := c.Conn.ReadJSON(&msg)
+		_, raw, err := c.Conn.ReadMessage()
 		if err != nil {
+			if err == websocket.ErrReadLimit {
+				log.Printf("WebSocket: Closing connection of %s: frame larger than %d bytes", c.UserID, c.Hub.limits.MaxFrameBytes)
+				break
+			}
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
 
+		msg, perr := decodeFrame(raw)
+		if perr != nil {
+			log.Printf("WebSocket: Rejected frame from %s: %v", c.UserID, perr)
+			c.reply(errorFrame(msg.ID, perr))
+			continue
+		}
+
+		if perr := c.admit(msg); perr != nil {
+			c.reply(errorFrame(msg.ID, perr))
+			if c.abusive() {
+				log.Printf("WebSocket: Closing connection of %s: %d frames throttled within %v", c.UserID, c.throttled, throttleWindow)
+				c.close(websocket.ClosePolicyViolation, "rate limit exceeded")
+				c.discard()
+				return
+			}
+			continue
+		}
+
+		if msg.Type == "hello" {
+			c.hello(msg)
+			continue
+		}
+
 		msg.SenderID = c.UserID
-		c.Hub.MessageQueue <- msg
+		msg.client = c
+		select {
+		case c.Hub.MessageQueue <- msg:
+		case <-c.Hub.quit:
+			return
+		}
+	}
+}
+
+// discard drops incoming frames until writePump has sent the close frame and
+// closed the connection, so the frames queued before it are not cut off
+func (c *Client) discard() {
+	for {
+		if _, _, err := c.Conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// hello answers a client's hello, closing the connection if the server does
+// not speak its protocol version
+func (c *Client) hello(msg MessagePayload) {
+	version := msg.Data.(*ClientHello).Version
+	if version != ProtocolVersion {
+		c.reply(errorFrame(msg.ID, protocolError(ErrCodeUnsupportedVersion,
+			"protocol version %d is not supported; this server speaks %d", version, ProtocolVersion)))
+		c.close(websocket.CloseProtocolError, "unsupported protocol version")
+		return
+	}
+	if msg.ID != "" {
+		c.reply(MessagePayload{Type: "ack", ID: msg.ID, Data: AckData{}})
+	}
+}
+
+// reply queues a frame for this connection only, dropping it if Send is full
+func (c *Client) reply(payload MessagePayload) {
+	select {
+	case c.Send <- payload:
+	default:
+		log.Printf("Client %s send buffer full for %s", c.UserID, payload.Type)
+	}
+}
+
+// close makes writePump send a close frame after the frames already queued and
+// end the connection
+func (c *Client) close(code int, text string) {
+	select {
+	case c.closing <- websocket.FormatCloseMessage(code, text):
+	default:
 	}
 }
 
@@ -116,6 +274,7 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+		c.Hub.pumps.Done()
 		log.Printf("WritePump: Client %s disconnected", c.UserID)
 	}()
 
@@ -136,12 +295,31 @@ func (c *Client) writePump() {
 				return
 			}
 
+		case closeFrame := <-c.closing:
+			for pending := len(c.Send); pending > 0; pending-- {
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.Conn.WriteJSON(<-c.Send); err != nil {
+					return
+				}
+			}
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Conn.WriteMessage(websocket.CloseMessage, closeFrame)
+			return
+
 		case <-ticker.C:
 			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				log.Printf("WritePump: Ping error for client %s: %v", c.UserID, err)
 				return
 			}
+
+		case <-c.Hub.quit:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			closeFrame := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server going away")
+			if err := c.Conn.WriteMessage(websocket.CloseMessage, closeFrame); err != nil {
+				log.Printf("WritePump: Close frame error for client %s: %v", c.UserID, err)
+			}
+			return
 		}
 	}
 }
@@ -7,17 +7,22 @@ import (
 	"time"
 
 	"social-nework/pkg/models"
+	"social-nework/pkg/repository"
 
 	"github.com/google/uuid"
 )
 
-func (h *Hub) handleNewMessage(msg MessagePayload) {
+// handleNewMessage saves a message from a "message" frame and broadcasts it to the chat
+func (h *Hub) handleNewMessage(msg MessagePayload) (string, error) {
 	log.Printf("DEBUG: handleNewMessage called - ChatID: %s, SenderID: %s", msg.ChatID, msg.SenderID)
 	
 	// Validate chat exists and user is participant
 	if !h.validateChatParticipation(msg.ChatID, msg.SenderID) {
 		log.Printf("ERROR: User %s not in chat %s", msg.SenderID, msg.ChatID)
-		return
+		return "", errNotInChat
+	}
+	if err := h.checkDirectChatBlocked(msg.ChatID, msg.SenderID); err != nil {
+		return "", err
 	}
 
 	// Save to database
@@ -29,13 +34,19 @@ func (h *Hub) handleNewMessage(msg MessagePayload) {
 		SentAt:   time.Now().Unix(),
 	}
 
-	if err := h.messageRepo.SaveMessage(&message); err != nil {
-		log.Printf("ERROR: Error saving message: %v", err)
-		return
+	attachmentIDs := msg.Data.(*SendMessageData).AttachmentIDs
+	if err := h.messageRepo.SaveMessageWithAttachments(&message, attachmentIDs); err != nil {
+		if err == repository.ErrInvalidAttachment {
+			return "", protocolError(ErrCodeInvalid, "%v", err)
+		}
+		return "", err
 	}
 	
 	log.Printf("SUCCESS: Message saved to database - ID: %s", message.ID)
 
+	// Sending a message ends the sender's typing indicator
+	h.stopTyping(msg.ChatID, msg.SenderID)
+
 	// Get chat participants for notifications
 	participants, err := h.chatRepo.GetChatParticipants(msg.ChatID)
 	if err != nil {
@@ -73,7 +84,7 @@ func (h *Hub) handleNewMessage(msg MessagePayload) {
 						log.Printf("SUCCESS: Message notification saved for user: %s", participantID)
 						
 						// Send real-time notification
-						h.SendNotification(participantID, notification, map[string]interface{}{
+						h.notify(participantID, notification, map[string]interface{}{
 							"chat_id":        msg.ChatID,
 							"sender_id":      msg.SenderID,
 							"message_id":     message.ID,
@@ -89,8 +100,9 @@ func (h *Hub) handleNewMessage(msg MessagePayload) {
 	// Get full message with sender details for broadcasting
 	fullMessage, err := h.messageRepo.GetMessageByID(message.ID)
 	if err != nil {
+		// Saved; the other participants will see it once they load the chat
 		log.Printf("ERROR: Failed to get full message details: %v", err)
-		return
+		return message.ID, nil
 	}
 
 	broadcastMsg := MessagePayload{
@@ -99,63 +111,37 @@ func (h *Hub) handleNewMessage(msg MessagePayload) {
 		Data:   fullMessage,
 	}
 
-	// Broadcast to chat participants
-	chat, ok := h.ChatRooms[msg.ChatID]
-	if !ok {
-		log.Printf("WARNING: Chat room %s not active", msg.ChatID)
-		return
-	}
-
-	log.Printf("DEBUG: Broadcasting message to %d participants", len(chat.Members))
-	for participantID := range chat.Members {
-		if client, exists := h.Clients[participantID]; exists {
-			select {
-			case client.Send <- broadcastMsg:
-				log.Printf("SUCCESS: Message broadcasted to participant: %s", participantID)
-			default:
-				log.Printf("ERROR: Failed to send message to participant %s - buffer full", participantID)
-			}
-		} else {
-			log.Printf("WARNING: Participant %s not connected", participantID)
-		}
-	}
+	// Broadcast to chat participants; those offline get it when they resume
+	h.sendToChat(msg.ChatID, broadcastMsg, "")
+	return message.ID, nil
 }
 
-func (h *Hub) handleHistoryRequest(msg MessagePayload) {
+// handleHistoryRequest answers a history_request with a page of the chat's messages
+func (h *Hub) handleHistoryRequest(msg MessagePayload) (string, error) {
 	// Validate chat participation
 	if !h.validateChatParticipation(msg.ChatID, msg.SenderID) {
-		return
+		return "", errNotInChat
 	}
 
+	// Validated by decodeFrame
 	var before time.Time
-	if data, ok := msg.Data.(map[string]interface{}); ok {
-		if ts, ok := data["before"].(string); ok {
-			before, _ = time.Parse(time.RFC3339, ts)
-		}
+	if ts := msg.Data.(*HistoryRequestData).Before; ts != "" {
+		before, _ = time.Parse(time.RFC3339, ts)
 	}
 
 	messages, err := h.messageRepo.GetChatMessages(msg.ChatID, before, 50)
 	if err != nil {
-		log.Printf("Error getting chat history: %v", err)
-		return
+		return "", err
 	}
 
-	client, ok := h.Clients[msg.SenderID]
-	if !ok {
-		return
-	}
-
-	response := MessagePayload{
-		Type:   "history_response",
-		ChatID: msg.ChatID,
-		Data:   messages,
-	}
-
-	select {
-	case client.Send <- response:
-	default:
-		log.Printf("Client %s send buffer full", msg.SenderID)
+	if msg.client != nil {
+		h.sendToClient(msg.client, MessagePayload{
+			Type:   "history_response",
+			ChatID: msg.ChatID,
+			Data:   messages,
+		})
 	}
+	return "", nil
 }
 
 func (h *Hub) validateChatParticipation(chatID, userID string) bool {
@@ -179,3 +165,16 @@ func (h *Hub) validateChatParticipation(chatID, userID string) bool {
 
 	return exists
 }
+
+// checkDirectChatBlocked returns errBlocked when chatID is a direct chat whose
+// other participant and userID have blocked one another
+func (h *Hub) checkDirectChatBlocked(chatID, userID string) error {
+	blocked, err := h.chatRepo.IsDirectChatBlocked(chatID, userID)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errBlocked
+	}
+	return nil
+}
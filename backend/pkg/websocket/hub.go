@@ -2,6 +2,7 @@
 package websocket
 
 import (
+	"context"
 	"database/sql"
 	"log"
 	"sync"
@@ -9,79 +10,219 @@ import (
 
 	"social-nework/pkg/repository"
 	"social-nework/pkg/models"
+
+	"github.com/gorilla/websocket"
 )
 
 type Hub struct {
 	// Connection management
-	Clients      map[string]*Client   // userID -> Client
+	Clients      map[string]map[*Client]bool // userID -> their connections, one per tab or device
 	ChatRooms    map[string]*ChatRoom // chatID -> ChatRoom
 	Register     chan *Client
 	Unregister   chan *Client
 	MessageQueue chan MessagePayload
 	mu           sync.RWMutex
 
+	// Shutdown coordination
+	quit     chan struct{}  // closed to stop Run and every client's writePump
+	done     chan struct{}  // closed when Run has returned
+	stopOnce sync.Once
+	pumps    sync.WaitGroup // running writePumps
+
 	// Database dependencies
 	db               *sql.DB
 	messageRepo      *repository.MessageRepository
 	chatRepo         *repository.ChatRepository
 	notificationModel *models.NotificationModel
+
+	// chatID -> userID -> when their typing indicator expires; only touched by Run
+	typing map[string]map[string]time.Time
+
+	// Presence changes waiting for flushPresence; only touched by Run
+	pendingPresence []PresenceData
+	// Status each user's contacts connected here were last told; only touched by Run
+	announced map[string]string
+
+	// Per-user sequence numbers and recent events for resume; see replay.go.
+	// Lock order is mu, then logsMu.
+	logs   map[string]*replayLog
+	logsMu sync.Mutex
+	epoch  string
+
+	// Other backend processes; see broker.go
+	broker         Broker
+	remote         chan BrokerEvent        // Events from other processes, delivered by Run
+	remotePresence map[string]map[string]PresenceData // Users connected to other processes, by user and then process
+
+	// What clients may send; see ratelimit.go
+	limits  Limits
+	senders userLimiter
+
+	// Origins whose pages may open /ws, as for CORS; see SetAllowedOrigins
+	origins  []string
+	upgrader websocket.Upgrader
 }
 type ChatRoom struct {
 	ID           string
 	Type         string // "direct" or "group"
-	Members      map[string]*Client
+	Members      map[string]bool // userIDs with at least one connection here
 	Participants map[string]*Client
 	CreatedAt    time.Time
 }
 
+// MessagePayload is a frame sent over a WebSocket connection. protocol.go lists
+// the types each side may send and the type of their Data.
 type MessagePayload struct {
-	Type      string      `json:"type"` // "message", "history_request"
+	ID        string      `json:"id,omitempty"` // Chosen by the client; echoed in the ack or error frame
+	Type      string      `json:"type"`
 	ChatID    string      `json:"chat_id"`
 	SenderID  string      `json:"sender_id"`
 	Content   string      `json:"content,omitempty"`
 	Timestamp int64   `json:"timestamp,omitempty"`
 	Data      interface{} `json:"data,omitempty"` // For additional payload
+	client    *Client     // Connection a client payload came from; not sent
+	Seq       uint64      `json:"seq,omitempty"`  // Per-recipient sequence number, set by deliver
 }
 
-// NewHub creates a new Hub instance with all required dependencies
-func NewHub(db *sql.DB, messageRepo *repository.MessageRepository, chatRepo *repository.ChatRepository) *Hub {
-	return &Hub{
-		Clients:      make(map[string]*Client),
+// NewHub creates a new Hub instance with all required dependencies. A nil
+// broker runs the hub as the only backend process.
+func NewHub(db *sql.DB, messageRepo *repository.MessageRepository, chatRepo *repository.ChatRepository, broker Broker) *Hub {
+	if broker == nil {
+		broker = NewLocalBroker()
+	}
+	h := &Hub{
+		Clients:      make(map[string]map[*Client]bool),
 		ChatRooms:    make(map[string]*ChatRoom),
 		Register:     make(chan *Client, 100),
 		Unregister:   make(chan *Client, 100),
 		MessageQueue: make(chan MessagePayload, 1000),
+		quit:         make(chan struct{}),
+		done:         make(chan struct{}),
 		db:           db,
 		messageRepo:  messageRepo,
 		chatRepo:     chatRepo,
+		typing:       make(map[string]map[string]time.Time),
+		announced:    make(map[string]string),
+		logs:         make(map[string]*replayLog),
+		epoch:        newEpoch(),
+
+		broker:         broker,
+		remote:         make(chan BrokerEvent, 1000),
+		remotePresence: make(map[string]map[string]PresenceData),
+
+		limits:  DefaultLimits(),
+		senders: userLimiter{buckets: make(map[string]*tokenBucket)},
+	}
+	h.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     h.checkOrigin,
 	}
+	return h
 }
 
 func (h *Hub) Run() {
+	defer close(h.done)
+	if err := h.broker.Subscribe(h.receive); err != nil {
+		log.Printf("Hub: failed to subscribe to other processes: %v", err)
+	}
+	typingTicker := time.NewTicker(typingSweepInterval)
+	defer typingTicker.Stop()
+	sweepTicker := time.NewTicker(replaySweepInterval)
+	defer sweepTicker.Stop()
 	for {
 		select {
+		case <-h.quit:
+			h.mu.RLock()
+			log.Printf("Hub: stopping with %d connected users", len(h.Clients))
+			h.mu.RUnlock()
+			return
+
 		case client := <-h.Register:
 			h.mu.Lock()
-			h.Clients[client.UserID] = client
+			previous := h.localStatus(client.UserID)
+			conns, ok := h.Clients[client.UserID]
+			if !ok {
+				conns = make(map[*Client]bool)
+				h.Clients[client.UserID] = conns
+			}
+			conns[client] = true
 			h.initializeUserChatRooms(client)
+			h.resume(client)
+			client.Status = StatusOnline
+			client.LastSeenAt = time.Now().Unix()
+			if previous != StatusOnline {
+				h.publishPresence(client.UserID, StatusOnline, client.LastSeenAt)
+			}
 			h.mu.Unlock()
+			h.sendPresenceSnapshot(client)
 
 		case client := <-h.Unregister:
 			h.mu.Lock()
-			delete(h.Clients, client.UserID)
-			h.cleanupDisconnectedClient(client)
+			if conns, ok := h.Clients[client.UserID]; ok && conns[client] {
+				previous := h.localStatus(client.UserID)
+				delete(conns, client)
+				// The user stays online until their last connection closes
+				if len(conns) == 0 {
+					h.stopAllTyping(client.UserID)
+					delete(h.Clients, client.UserID)
+					h.cleanupDisconnectedClient(client)
+				}
+				if status := h.localStatus(client.UserID); status != previous {
+					h.publishPresence(client.UserID, status, time.Now().Unix())
+				}
+			}
 			h.mu.Unlock()
 
+		case now := <-typingTicker.C:
+			h.mu.RLock()
+			h.expireTyping(now)
+			h.mu.RUnlock()
+
+		case event := <-h.remote:
+			h.mu.Lock()
+			h.handleRemote(event)
+			h.mu.Unlock()
+
+		case now := <-sweepTicker.C:
+			h.mu.RLock()
+			h.expireReplayLogs(now)
+			h.mu.RUnlock()
+			h.senders.prune(now)
+
 		case msg := <-h.MessageQueue:
 			h.mu.RLock()
-			switch msg.Type {
-			case "message":
-				h.handleNewMessage(msg)
-			case "history_request":
-				h.handleHistoryRequest(msg)
-			}
+			h.handleFrame(msg)
 			h.mu.RUnlock()
 		}
+
+		// Presence changes need the database, so they go out once h.mu is released
+		h.flushPresence()
+	}
+}
+
+// Shutdown stops Run and waits until every connected client has been sent a
+// going-away close frame, or until ctx expires
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.quit) })
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	pumpsDone := make(chan struct{})
+	go func() {
+		h.pumps.Wait()
+		close(pumpsDone)
+	}()
+
+	select {
+	case <-pumpsDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -96,7 +237,7 @@ func (h *Hub) InitializeChatRoom(chatID, chatType string, participantIDs []strin
 		chatRoom = &ChatRoom{
 			ID:        chatID,
 			Type:      chatType,
-			Members:   make(map[string]*Client),
+			Members:   make(map[string]bool),
 			CreatedAt: time.Now(),
 		}
 		h.ChatRooms[chatID] = chatRoom
@@ -104,13 +245,15 @@ func (h *Hub) InitializeChatRoom(chatID, chatType string, participantIDs []strin
 
 	// Add connected participants to the room
 	for _, userID := range participantIDs {
-		if client, ok := h.Clients[userID]; ok {
-			chatRoom.Members[userID] = client
-
-			// Update client's chat list
-			client.mu.Lock()
-			client.Chats[chatID] = true
-			client.mu.Unlock()
+		if conns, ok := h.Clients[userID]; ok {
+			chatRoom.Members[userID] = true
+
+			// Update the chat list of each of their connections
+			for client := range conns {
+				client.mu.Lock()
+				client.Chats[chatID] = true
+				client.mu.Unlock()
+			}
 		}
 	}
 }
@@ -126,13 +269,15 @@ func (h *Hub) AddUserToChatRoom(chatID, userID string) {
 	}
 
 	// Add user if they're connected
-	if client, ok := h.Clients[userID]; ok {
-		chatRoom.Members[userID] = client
+	if conns, ok := h.Clients[userID]; ok {
+		chatRoom.Members[userID] = true
 
-		// Update client's chat list
-		client.mu.Lock()
-		client.Chats[chatID] = true
-		client.mu.Unlock()
+		// Update the chat list of each of their connections
+		for client := range conns {
+			client.mu.Lock()
+			client.Chats[chatID] = true
+			client.mu.Unlock()
+		}
 	}
 }
 
@@ -148,8 +293,8 @@ func (h *Hub) RemoveUserFromChatRoom(chatID, userID string) {
 
 	delete(chatRoom.Members, userID)
 
-	// Update client's chat list if they're connected
-	if client, ok := h.Clients[userID]; ok {
+	// Update the chat list of each of their connections
+	for client := range h.Clients[userID] {
 		client.mu.Lock()
 		delete(client.Chats, chatID)
 		client.mu.Unlock()
@@ -161,35 +306,14 @@ func (h *Hub) RemoveUserFromChatRoom(chatID, userID string) {
 	}
 }
 
-// BroadcastToChatRoom sends a message to all members of a chat room except the sender
+// BroadcastToChatRoom sends a message to all participants of a chat except the
+// sender. Participants who are not connected get it when they resume.
 func (h *Hub) BroadcastToChatRoom(chatID string, message MessagePayload, excludeUserID string) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	log.Printf("BroadcastToChatRoom: Broadcasting to chat %s, excluding %s", chatID, excludeUserID)
-
-	chatRoom, exists := h.ChatRooms[chatID]
-	if !exists {
-		log.Printf("BroadcastToChatRoom: Chat room %s not found for broadcast", chatID)
-		return
-	}
-
-	log.Printf("BroadcastToChatRoom: Chat room %s has %d members", chatID, len(chatRoom.Members))
-
-	for userID, client := range chatRoom.Members {
-		if userID == excludeUserID {
-			log.Printf("BroadcastToChatRoom: Skipping sender %s", userID)
-			continue
-		}
-
-		log.Printf("BroadcastToChatRoom: Sending to user %s", userID)
-		select {
-		case client.Send <- message:
-			log.Printf("BroadcastToChatRoom: Message sent to user %s", userID)
-		default:
-			log.Printf("BroadcastToChatRoom: Client %s send buffer full during broadcast", userID)
-		}
-	}
+	h.sendToChat(chatID, message, excludeUserID)
 }
 
 // Complete the initializeUserChatRooms method that was stubbed
@@ -225,15 +349,17 @@ func (h *Hub) initializeUserChatRooms(client *Client) {
 			chatRoom = &ChatRoom{
 				ID:        chatID,
 				Type:      "direct", // You might want to query this from database
-				Members:   make(map[string]*Client),
+				Members:   make(map[string]bool),
 				CreatedAt: time.Now(),
 			}
 			h.ChatRooms[chatID] = chatRoom
 		}
 
 		// Add this client to the chat room
-		chatRoom.Members[client.UserID] = client
+		chatRoom.Members[client.UserID] = true
+		client.mu.Lock()
 		client.Chats[chatID] = true
+		client.mu.Unlock()
 		
 		log.Printf("initializeUserChatRooms: Added user %s to chat room %s. Room now has %d members", 
 			client.UserID, chatID, len(chatRoom.Members))
@@ -249,7 +375,7 @@ func (h *Hub) GetChatRoomInfo(chatID string) (*ChatRoom, bool) {
 	return chatRoom, exists
 }
 
-// GetConnectedUsers returns a list of connected user IDs
+// GetConnectedUsers returns a list of user IDs connected to this process
 func (h *Hub) GetConnectedUsers() []string {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -261,32 +387,31 @@ func (h *Hub) GetConnectedUsers() []string {
 	return users
 }
 
-// IsUserOnline checks if a user is currently connected
+// IsUserOnline checks if a user is currently connected to any backend process
 func (h *Hub) IsUserOnline(userID string) bool {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	_, exists := h.Clients[userID]
-	return exists
+	return h.isOnline(userID)
 }
 
-// SendDirectMessage sends a message directly to a specific user
+// isOnline is IsUserOnline for callers already holding h.mu
+func (h *Hub) isOnline(userID string) bool {
+	// Not presenceOf: connection statuses are only read and written by Run
+	if _, exists := h.Clients[userID]; exists {
+		return true
+	}
+	return len(h.remotePresence[userID]) > 0
+}
+
+// SendDirectMessage sends a message directly to a specific user. It reports
+// whether they are connected; if not, they get it when they resume.
 func (h *Hub) SendDirectMessage(userID string, message MessagePayload) bool {
 	h.mu.RLock()
-	client, exists := h.Clients[userID]
-	h.mu.RUnlock()
-
-	if !exists {
-		return false
-	}
+	defer h.mu.RUnlock()
 
-	select {
-	case client.Send <- message:
-		return true
-	default:
-		log.Printf("Client %s send buffer full for direct message", userID)
-		return false
-	}
+	h.fanout(BrokerEvent{Recipients: []string{userID}, Payload: message})
+	return h.isOnline(userID)
 }
 
 func (h *Hub) cleanupDisconnectedClient(client *Client) {
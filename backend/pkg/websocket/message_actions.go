@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"social-nework/pkg/models"
+	"social-nework/pkg/repository"
+)
+
+// chatMessage checks the sender takes part in the payload's chat and that the
+// message is a live message of that chat
+func (h *Hub) chatMessage(msg MessagePayload, messageID string) error {
+	if !h.validateChatParticipation(msg.ChatID, msg.SenderID) {
+		log.Printf("ERROR: User %s cannot act on message %q in chat %s", msg.SenderID, messageID, msg.ChatID)
+		return errNotInChat
+	}
+
+	message, err := h.messageRepo.GetMessageByID(messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errMessageNotFound
+		}
+		return err
+	}
+	if message.ChatID != msg.ChatID {
+		log.Printf("ERROR: Message %s is not in chat %s", messageID, msg.ChatID)
+		return errMessageNotFound
+	}
+	return nil
+}
+
+var errMessageNotFound = &ProtocolError{Code: ErrCodeNotFound, Message: "no such message in this chat"}
+
+// messageActionError maps repository errors to the codes clients see
+func messageActionError(err error) error {
+	switch err {
+	case repository.ErrMessageNotFound:
+		return errMessageNotFound
+	case repository.ErrNotMessageSender:
+		return protocolError(ErrCodeForbidden, "only the sender can change this message")
+	case repository.ErrEmptyMessage, models.ErrInvalidReaction:
+		return protocolError(ErrCodeInvalid, "%v", err)
+	}
+	return err
+}
+
+// handleEditMessage lets the sender change a message and updates it for every member of the chat
+func (h *Hub) handleEditMessage(msg MessagePayload) (string, error) {
+	action := msg.Data.(*MessageActionData)
+	if err := h.chatMessage(msg, action.MessageID); err != nil {
+		return "", err
+	}
+	if err := h.checkDirectChatBlocked(msg.ChatID, msg.SenderID); err != nil {
+		return "", err
+	}
+
+	if err := h.messageRepo.EditMessage(action.MessageID, msg.SenderID, msg.Content); err != nil {
+		return "", messageActionError(err)
+	}
+
+	message, err := h.messageRepo.GetMessageByID(action.MessageID)
+	if err != nil {
+		log.Printf("ERROR: Failed to reload edited message %s: %v", action.MessageID, err)
+		return action.MessageID, nil
+	}
+
+	h.sendToChat(msg.ChatID, MessagePayload{
+		Type:      "message_edited",
+		ChatID:    msg.ChatID,
+		SenderID:  msg.SenderID,
+		Timestamp: *message.EditedAt,
+		Data:      message,
+	}, "")
+	return action.MessageID, nil
+}
+
+// handleDeleteMessage lets the sender delete a message and removes it for every member of the chat
+func (h *Hub) handleDeleteMessage(msg MessagePayload) (string, error) {
+	action := msg.Data.(*MessageActionData)
+	if err := h.chatMessage(msg, action.MessageID); err != nil {
+		return "", err
+	}
+
+	if err := h.messageRepo.DeleteMessage(action.MessageID, msg.SenderID); err != nil {
+		return "", messageActionError(err)
+	}
+
+	h.sendToChat(msg.ChatID, MessagePayload{
+		Type:      "message_deleted",
+		ChatID:    msg.ChatID,
+		SenderID:  msg.SenderID,
+		Timestamp: time.Now().Unix(),
+		Data:      MessageDeletedData{MessageID: action.MessageID},
+	}, "")
+	return action.MessageID, nil
+}
+
+// handleReactMessage sets or, with an empty reaction, clears the sender's reaction on a message
+func (h *Hub) handleReactMessage(msg MessagePayload) (string, error) {
+	action := msg.Data.(*MessageActionData)
+	if err := h.chatMessage(msg, action.MessageID); err != nil {
+		return "", err
+	}
+	if err := h.checkDirectChatBlocked(msg.ChatID, msg.SenderID); err != nil {
+		return "", err
+	}
+
+	if err := h.messageRepo.SetMessageReaction(action.MessageID, msg.SenderID, action.Reaction); err != nil {
+		return "", messageActionError(err)
+	}
+
+	reactions, err := h.messageRepo.GetMessageReactions([]string{action.MessageID})
+	if err != nil {
+		log.Printf("ERROR: Failed to load reactions for message %s: %v", action.MessageID, err)
+		return action.MessageID, nil
+	}
+
+	h.sendToChat(msg.ChatID, MessagePayload{
+		Type:      "message_reaction",
+		ChatID:    msg.ChatID,
+		SenderID:  msg.SenderID,
+		Timestamp: time.Now().Unix(),
+		Data: MessageReactionData{
+			MessageID: action.MessageID,
+			UserID:    msg.SenderID,
+			Reaction:  action.Reaction,
+			Reactions: reactions[action.MessageID],
+		},
+	}, "")
+	return action.MessageID, nil
+}
@@ -17,18 +17,15 @@ type NotificationPayload struct {
 func (h *Hub) SendNotification(userID string, notification models.Notification, additionalData map[string]interface{}) {
 	log.Printf("DEBUG: SendNotification called - UserID: %s, Type: %s, NotificationID: %s",
 		userID, notification.Type, notification.ID)
-	
-	h.mu.RLock()
-	client, exists := h.Clients[userID]
-	h.mu.RUnlock()
-
-	if !exists {
-		log.Printf("WARNING: SendNotification: User %s not connected, notification will be stored only", userID)
-		return
-	}
 
-	log.Printf("DEBUG: User %s is connected, preparing notification payload", userID)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.notify(userID, notification, additionalData)
+}
 
+// notify queues a notification for a user; those who are not connected get it
+// when they resume. Unlike SendNotification the caller must already hold h.mu.
+func (h *Hub) notify(userID string, notification models.Notification, additionalData map[string]interface{}) {
 	// Ensure created_at is properly formatted
 	createdAtTime := notification.CreatedAt
 	if createdAtTime.IsZero() {
@@ -49,12 +46,8 @@ func (h *Hub) SendNotification(userID string, notification models.Notification,
 		Data: payload,
 	}
 
-	select {
-	case client.Send <- messagePayload:
-		log.Printf("SUCCESS: Real-time notification sent to user %s (NotificationID: %s)", userID, notification.ID)
-	default:
-		log.Printf("ERROR: Client %s send buffer full for notification %s", userID, notification.ID)
-	}
+	h.fanout(BrokerEvent{Recipients: []string{userID}, Payload: messagePayload})
+	log.Printf("SUCCESS: Real-time notification queued for user %s (NotificationID: %s)", userID, notification.ID)
 }
 
 // BroadcastNotificationToGroup sends a notification to all members of a group
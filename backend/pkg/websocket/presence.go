@@ -0,0 +1,344 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"social-nework/pkg/models"
+)
+
+// Presence statuses sent in "presence" payloads
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+)
+
+const (
+	// typingTimeout is how long a typing_start lasts without being renewed
+	typingTimeout = 6 * time.Second
+	// typingSweepInterval is how often Run expires stale typing indicators
+	typingSweepInterval = time.Second
+)
+
+// PresenceData is the Data of a "presence" payload
+type PresenceData struct {
+	UserID     string `json:"user_id"`
+	Status     string `json:"status"`
+	LastSeenAt int64  `json:"last_seen_at"`
+}
+
+// handleTyping records or clears the sender's typing state in a chat and tells
+// the other members of the room. Typing state is only touched from Run.
+func (h *Hub) handleTyping(msg MessagePayload) (string, error) {
+	if !h.validateChatParticipation(msg.ChatID, msg.SenderID) {
+		log.Printf("ERROR: User %s not in chat %s", msg.SenderID, msg.ChatID)
+		return "", errNotInChat
+	}
+
+	if msg.Type == "typing_start" {
+		if err := h.checkDirectChatBlocked(msg.ChatID, msg.SenderID); err != nil {
+			return "", err
+		}
+		typers, ok := h.typing[msg.ChatID]
+		if !ok {
+			typers = make(map[string]time.Time)
+			h.typing[msg.ChatID] = typers
+		}
+		_, already := typers[msg.SenderID]
+		typers[msg.SenderID] = time.Now().Add(typingTimeout)
+		if already {
+			// Renewal; members already show the indicator
+			return "", nil
+		}
+		h.sendToRoom(msg.ChatID, MessagePayload{
+			Type:      "typing_start",
+			ChatID:    msg.ChatID,
+			SenderID:  msg.SenderID,
+			Timestamp: time.Now().Unix(),
+		}, msg.SenderID)
+		return "", nil
+	}
+
+	h.stopTyping(msg.ChatID, msg.SenderID)
+	return "", nil
+}
+
+// stopTyping clears a user's typing state in a chat and broadcasts typing_stop if it was set
+func (h *Hub) stopTyping(chatID, userID string) {
+	typers, ok := h.typing[chatID]
+	if !ok {
+		return
+	}
+	if _, ok := typers[userID]; !ok {
+		return
+	}
+	delete(typers, userID)
+	if len(typers) == 0 {
+		delete(h.typing, chatID)
+	}
+
+	h.sendToRoom(chatID, MessagePayload{
+		Type:      "typing_stop",
+		ChatID:    chatID,
+		SenderID:  userID,
+		Timestamp: time.Now().Unix(),
+	}, userID)
+}
+
+// expireTyping stops typing indicators that have not been renewed in time
+func (h *Hub) expireTyping(now time.Time) {
+	for chatID, typers := range h.typing {
+		for userID, expires := range typers {
+			if now.After(expires) {
+				h.stopTyping(chatID, userID)
+			}
+		}
+	}
+}
+
+// stopAllTyping clears every typing indicator of a disconnected user
+func (h *Hub) stopAllTyping(userID string) {
+	for chatID := range h.typing {
+		h.stopTyping(chatID, userID)
+	}
+}
+
+// handlePresence lets a client switch between online and away
+func (h *Hub) handlePresence(msg MessagePayload) (string, error) {
+	status := msg.Data.(*PresenceRequestData).Status
+
+	// Each connection has its own status; the user is away only once all of them
+	// are, on every process
+	client := msg.client
+	if client == nil || !h.Clients[msg.SenderID][client] || client.Status == status {
+		return "", nil
+	}
+	previous := h.localStatus(msg.SenderID)
+	client.Status = status
+	client.LastSeenAt = time.Now().Unix()
+	if current := h.localStatus(msg.SenderID); current != previous {
+		h.publishPresence(msg.SenderID, current, client.LastSeenAt)
+	}
+	return "", nil
+}
+
+// localStatus combines the status of a user's connections to this process:
+// online if any is, away if all are, offline without any. It is what this
+// process publishes to the others.
+func (h *Hub) localStatus(userID string) string {
+	conns, ok := h.Clients[userID]
+	if !ok {
+		return StatusOffline
+	}
+	for client := range conns {
+		if client.Status == StatusOnline {
+			return StatusOnline
+		}
+	}
+	return StatusAway
+}
+
+// lastSeenAt is the latest activity across a user's connections to this process
+func (h *Hub) lastSeenAt(userID string) int64 {
+	var last int64
+	for client := range h.Clients[userID] {
+		last = max(last, client.LastSeenAt)
+	}
+	return last
+}
+
+// presenceOf combines a user's presence on this process with what the other
+// processes reported: online if any connection anywhere is, away if all are,
+// offline without any. Connection statuses change under h.mu held for reading,
+// so only Run may call it.
+func (h *Hub) presenceOf(userID string) PresenceData {
+	data := PresenceData{UserID: userID, Status: h.localStatus(userID), LastSeenAt: h.lastSeenAt(userID)}
+	for _, remote := range h.remotePresence[userID] {
+		if data.Status == StatusOffline || remote.Status == StatusOnline {
+			data.Status = remote.Status
+		}
+		data.LastSeenAt = max(data.LastSeenAt, remote.LastSeenAt)
+	}
+	return data
+}
+
+// announcePresence tells the recipients connected here the user's combined
+// presence after change, unless that is what they were last told. A process
+// going offline is not news while the user is still connected elsewhere. The
+// caller must hold h.mu and be Run.
+func (h *Hub) announcePresence(change PresenceData, recipients []string) {
+	data := h.presenceOf(change.UserID)
+	data.LastSeenAt = max(data.LastSeenAt, change.LastSeenAt)
+
+	previous, ok := h.announced[data.UserID]
+	if !ok {
+		previous = StatusOffline
+	}
+	if data.Status == previous {
+		return
+	}
+	if data.Status == StatusOffline {
+		delete(h.announced, data.UserID)
+	} else {
+		h.announced[data.UserID] = data.Status
+	}
+
+	h.dispatch(BrokerEvent{
+		Recipients: recipients,
+		Ephemeral:  true,
+		Payload: MessagePayload{
+			Type:      "presence",
+			SenderID:  data.UserID,
+			Timestamp: data.LastSeenAt,
+			Data:      data,
+		},
+	})
+}
+
+// publishPresence queues a change of the user's presence for flushPresence.
+// The caller must hold h.mu and be Run.
+func (h *Hub) publishPresence(userID, status string, now int64) {
+	h.pendingPresence = append(h.pendingPresence, PresenceData{UserID: userID, Status: status, LastSeenAt: now})
+}
+
+// flushPresence persists last_seen_at for each queued presence change, tells
+// the user's followers and chat partners that are connected and publishes the
+// change to the other processes. Run calls it without holding h.mu so the
+// database is not read under the lock.
+func (h *Hub) flushPresence() {
+	pending := h.pendingPresence
+	h.pendingPresence = nil
+
+	for _, data := range pending {
+		if _, err := h.db.Exec(`UPDATE users SET last_seen_at = ? WHERE id = ?`, data.LastSeenAt, data.UserID); err != nil {
+			log.Printf("ERROR: Failed to update last_seen_at for %s: %v", data.UserID, err)
+		}
+
+		contacts, err := h.presenceContacts(data.UserID, false)
+		if err != nil {
+			log.Printf("ERROR: Failed to get presence contacts for %s: %v", data.UserID, err)
+		}
+
+		h.mu.RLock()
+		h.announcePresence(data, contacts)
+		h.mu.RUnlock()
+
+		// Published even without contacts so other processes know who is online
+		err = h.broker.Publish(BrokerEvent{
+			Recipients: contacts,
+			Ephemeral:  true,
+			Presence:   &data,
+			Payload: MessagePayload{
+				Type:      "presence",
+				SenderID:  data.UserID,
+				Timestamp: data.LastSeenAt,
+				Data:      data,
+			},
+		})
+		if err != nil {
+			log.Printf("ERROR: Failed to publish presence of %s to other processes: %v", data.UserID, err)
+		}
+	}
+}
+
+// sendPresenceSnapshot tells a newly connected client which of their contacts are online,
+// on this process or another. Run calls it without holding h.mu.
+func (h *Hub) sendPresenceSnapshot(client *Client) {
+	contacts, err := h.presenceContacts(client.UserID, true)
+	if err != nil {
+		log.Printf("ERROR: Failed to get presence contacts for %s: %v", client.UserID, err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, contactID := range contacts {
+		data := h.presenceOf(contactID)
+		if data.Status == StatusOffline {
+			continue
+		}
+		h.sendToClient(client, MessagePayload{
+			Type:     "presence",
+			SenderID: contactID,
+			Data:     data,
+		})
+	}
+}
+
+// presenceContacts returns everyone sharing a chat with the user, plus their
+// accepted followers, or the users they follow when following is set. The
+// first set may see the user's presence; the second is whose presence they see.
+// Users blocked either way are left out of both.
+func (h *Hub) presenceContacts(userID string, following bool) ([]string, error) {
+	follows := `SELECT follower_id AS id FROM follows WHERE followed_id = ?`
+	if following {
+		follows = `SELECT followed_id AS id FROM follows WHERE follower_id = ?`
+	}
+	blocked, blockedArgs := models.BlockedSQL("contact.id", userID)
+	rows, err := h.db.Query(`SELECT contact.id FROM (`+follows+` AND status = 'accepted' AND deleted_at IS NULL
+		UNION
+		SELECT other.user_id FROM chat_participants me
+		JOIN chat_participants other ON other.chat_id = me.chat_id
+		WHERE me.user_id = ? AND me.deleted_at IS NULL AND other.deleted_at IS NULL
+		AND other.user_id != ?) contact
+		WHERE NOT `+blocked, append([]interface{}{userID, userID, userID}, blockedArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		contacts = append(contacts, id)
+	}
+	return contacts, rows.Err()
+}
+
+// sendToRoom delivers a payload to every connected participant of a chat except
+// excludeUserID. It suits events that mean nothing to someone who reconnects
+// later; use sendToChat for the rest. Unlike BroadcastToChatRoom the caller
+// must already hold h.mu.
+func (h *Hub) sendToRoom(chatID string, payload MessagePayload, excludeUserID string) {
+	h.fanout(BrokerEvent{
+		Recipients: h.chatRecipients(chatID, excludeUserID),
+		Ephemeral:  true,
+		Payload:    payload,
+	})
+}
+
+// sendToChat delivers a payload to every participant of a chat except
+// excludeUserID, connected or not, so those offline can replay it on resume.
+// The caller must hold h.mu.
+func (h *Hub) sendToChat(chatID string, payload MessagePayload, excludeUserID string) {
+	h.fanout(BrokerEvent{
+		Recipients: h.chatRecipients(chatID, excludeUserID),
+		Payload:    payload,
+	})
+}
+
+// chatRecipients lists a chat's participants except excludeUserID, falling back
+// to the members connected here if the database cannot be read
+func (h *Hub) chatRecipients(chatID, excludeUserID string) []string {
+	participants, err := h.chatRepo.GetChatParticipants(chatID)
+	if err != nil {
+		log.Printf("ERROR: Failed to get participants of chat %s: %v", chatID, err)
+		if room, ok := h.ChatRooms[chatID]; ok {
+			for userID := range room.Members {
+				participants = append(participants, userID)
+			}
+		}
+	}
+
+	recipients := participants[:0]
+	for _, userID := range participants {
+		if userID != excludeUserID {
+			recipients = append(recipients, userID)
+		}
+	}
+	return recipients
+}
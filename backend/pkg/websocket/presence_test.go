@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBlockedUsersSeeNoPresenceOrActivity checks that once two users in a direct
+// chat block one another, neither sees the other's presence, typing, edits or
+// reactions, while a third user in a group chat with them still does
+func TestBlockedUsersSeeNoPresenceOrActivity(t *testing.T) {
+	hub := startHub(t, filepath.Join(t.TempDir(), "test.db"))
+
+	fixture := []string{
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('alice', 'alice@test', 'x', 'alice', 'test', 'alice', '', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('bob', 'bob@test', 'x', 'bob', 'test', 'bob', '', 1, 1)`,
+		`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('carol', 'carol@test', 'x', 'carol', 'test', 'carol', '', 1, 1)`,
+		`INSERT INTO follows (id, follower_id, followed_id, status, created_at) VALUES ('f1', 'bob', 'alice', 'accepted', 1)`,
+		`INSERT INTO chats (id, type, created_at) VALUES ('direct', 'direct', 1)`,
+		`INSERT INTO chat_participants (id, chat_id, user_id, joined_at) VALUES ('p1', 'direct', 'alice', 1)`,
+		`INSERT INTO chat_participants (id, chat_id, user_id, joined_at) VALUES ('p2', 'direct', 'bob', 1)`,
+		`INSERT INTO chats (id, type, created_at) VALUES ('group', 'group', 1)`,
+		`INSERT INTO chat_participants (id, chat_id, user_id, joined_at) VALUES ('p3', 'group', 'alice', 1)`,
+		`INSERT INTO chat_participants (id, chat_id, user_id, joined_at) VALUES ('p4', 'group', 'carol', 1)`,
+		`INSERT INTO messages (id, chat_id, sender_id, content, sent_at) VALUES ('m1', 'direct', 'alice', 'hi', 1)`,
+		`INSERT INTO blocks (blocker_id, blocked_id, kind, created_at) VALUES ('bob', 'alice', 'block', 1)`,
+	}
+	for _, stmt := range fixture {
+		if _, err := hub.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	bob := connect(t, hub, "bob")
+	carol := connect(t, hub, "carol")
+	alice := connect(t, hub, "alice")
+
+	if got := receive(carol, 2*time.Second, func(got []MessagePayload) bool { return count(got, "presence", "alice") > 0 }); count(got, "presence", "alice") != 1 {
+		t.Errorf("carol got %d presence events from alice, want 1", count(got, "presence", "alice"))
+	}
+	if got := receive(alice, 200*time.Millisecond, nil); count(got, "presence", "bob") != 0 {
+		t.Errorf("alice got bob's presence in her snapshot")
+	}
+
+	frames := []MessagePayload{
+		{ID: "t", Type: "typing_start", ChatID: "direct"},
+		{ID: "e", Type: "edit_message", ChatID: "direct", Content: "edited", Data: &MessageActionData{MessageID: "m1"}},
+		{ID: "r", Type: "react_message", ChatID: "direct", Data: &MessageActionData{MessageID: "m1", Reaction: "like"}},
+		{ID: "g", Type: "typing_start", ChatID: "group"},
+	}
+	for _, frame := range frames {
+		frame.SenderID = "alice"
+		frame.client = alice
+		hub.MessageQueue <- frame
+	}
+
+	got := receive(alice, 2*time.Second, func(got []MessagePayload) bool { return count(got, "error", "")+count(got, "ack", "") >= len(frames) })
+	errs := map[string]string{}
+	for _, p := range got {
+		if p.Type == "error" {
+			errs[p.ID] = p.Data.(*ProtocolError).Code
+		}
+	}
+	for _, id := range []string{"t", "e", "r"} {
+		if errs[id] != ErrCodeForbidden {
+			t.Errorf("frame %s got error %q, want %q", id, errs[id], ErrCodeForbidden)
+		}
+	}
+	if _, ok := errs["g"]; ok {
+		t.Errorf("typing in the group chat failed: %s", errs["g"])
+	}
+
+	if got := receive(carol, time.Second, func(got []MessagePayload) bool { return count(got, "typing_start", "alice") > 0 }); count(got, "typing_start", "alice") != 1 {
+		t.Errorf("carol got %d typing_start events from alice, want 1", count(got, "typing_start", "alice"))
+	}
+	got = receive(bob, 200*time.Millisecond, nil)
+	for _, typ := range []string{"presence", "typing_start", "message_edited", "message_reaction"} {
+		if n := count(got, typ, "alice"); n != 0 {
+			t.Errorf("bob got %d %s events from alice, want 0", n, typ)
+		}
+	}
+}
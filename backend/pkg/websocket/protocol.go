@@ -0,0 +1,361 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"social-nework/pkg/models"
+)
+
+// ProtocolVersion is the version of the frames described in this file. Bump it
+// for changes clients written against an older version cannot handle.
+const ProtocolVersion = 1
+
+// maxFrameIDLength bounds the client-generated id echoed in ack and error frames
+const maxFrameIDLength = 64
+
+// Codes of "error" frames
+const (
+	ErrCodeBadFrame           = "bad_frame"           // Not JSON, or does not match the schema of its type
+	ErrCodeUnknownType        = "unknown_type"        // Not a type clients may send
+	ErrCodeUnsupportedVersion = "unsupported_version" // Reply to a hello; the connection is then closed
+	ErrCodeForbidden          = "forbidden"           // Not a participant of the chat, not the message's sender, or blocked
+	ErrCodeNotFound           = "not_found"           // No such message in the chat
+	ErrCodeInvalid            = "invalid"             // Well formed but refused, e.g. an empty message
+	ErrCodeTooLarge           = "too_large"           // Content longer than the server allows
+	ErrCodeRateLimited        = "rate_limited"        // Sent too fast; retry after retry_after_ms
+	ErrCodeInternal           = "internal"            // Failed on the server; the frame may be retried
+)
+
+// ProtocolError is the Data of an "error" frame
+type ProtocolError struct {
+	Code         string `json:"code"`
+	Message      string `json:"message"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // Set with rate_limited
+}
+
+func (e *ProtocolError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func protocolError(code, format string, args ...interface{}) *ProtocolError {
+	return &ProtocolError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	errNotInChat = &ProtocolError{Code: ErrCodeForbidden, Message: "not a participant of this chat"}
+	errBlocked   = &ProtocolError{Code: ErrCodeForbidden, Message: "cannot message this user"}
+	errInternal  = &ProtocolError{Code: ErrCodeInternal, Message: "internal error"}
+)
+
+// Data of frames clients send
+
+// ClientHello is the Data of a "hello" frame. Clients may send it first to
+// check the server speaks their version.
+type ClientHello struct {
+	Version int `json:"version"`
+}
+
+// SendMessageData is the Data of a "message" frame
+type SendMessageData struct {
+	AttachmentIDs []string `json:"attachment_ids,omitempty"` // Uploaded with POST /api/chats/{chatId}/attachments
+}
+
+// HistoryRequestData is the Data of a "history_request" frame
+type HistoryRequestData struct {
+	Before string `json:"before,omitempty"` // RFC 3339; the latest messages when empty
+}
+
+// PresenceRequestData is the Data of a "presence" frame
+type PresenceRequestData struct {
+	Status string `json:"status"` // "online" or "away"
+}
+
+// MarkReadData is the Data of a "mark_read" frame
+type MarkReadData struct {
+	MessageID string `json:"message_id,omitempty"` // The latest message when empty
+}
+
+// MessageActionData is the Data of edit_message, delete_message and react_message frames
+type MessageActionData struct {
+	MessageID string `json:"message_id"`
+	Reaction  string `json:"reaction,omitempty"` // react_message only; empty removes the reaction
+}
+
+// Data of frames the server sends
+
+// ServerHello is the Data of the "hello" frame sent first on every connection
+type ServerHello struct {
+	Version int    `json:"version"`
+	Epoch   string `json:"epoch"` // Changes when the server restarts; resume only within one epoch
+	Seq     uint64 `json:"seq"`   // The user's latest sequence number
+}
+
+// SyncState is the Data of a "resync_required" frame
+type SyncState struct {
+	Epoch string `json:"epoch"`
+	Seq   uint64 `json:"seq"`
+}
+
+// ResumeComplete is the Data of a "resume_complete" frame
+type ResumeComplete struct {
+	Replayed int    `json:"replayed"`
+	Seq      uint64 `json:"seq"`
+}
+
+// AckData is the Data of an "ack" frame
+type AckData struct {
+	MessageID string `json:"message_id,omitempty"` // The chat message sent, changed or read
+}
+
+// MessageDeletedData is the Data of a "message_deleted" frame
+type MessageDeletedData struct {
+	MessageID string `json:"message_id"`
+}
+
+// MessageReactionData is the Data of a "message_reaction" frame
+type MessageReactionData struct {
+	MessageID string              `json:"message_id"`
+	UserID    string              `json:"user_id"`
+	Reaction  string              `json:"reaction"` // Empty when removed
+	Reactions map[string][]string `json:"reactions"`
+}
+
+// MemberData is the Data of participant_added, member_joined and member_left frames
+type MemberData struct {
+	UserID    string    `json:"user_id"`
+	AddedBy   string    `json:"added_by,omitempty"`
+	GroupID   string    `json:"group_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// inboundFrame describes a frame type clients may send
+type inboundFrame struct {
+	doc     string
+	chat    bool                                             // chat_id is required
+	content bool                                             // content is required
+	data    func() interface{}                               // New value to decode data into; nil if the type takes none
+	check   func(msg MessagePayload) *ProtocolError          // Further checks once decoded
+	handle  func(h *Hub, msg MessagePayload) (string, error) // Run by Hub.Run; returns the ID for the ack
+}
+
+// inboundFrames lists every type clients may send. "hello" is answered by the
+// connection itself and never reaches Run.
+var inboundFrames = map[string]inboundFrame{
+	"hello": {
+		doc:  "Announces the protocol version the client speaks",
+		data: func() interface{} { return &ClientHello{} },
+		check: func(msg MessagePayload) *ProtocolError {
+			if msg.Data.(*ClientHello).Version <= 0 {
+				return protocolError(ErrCodeBadFrame, "data.version is required")
+			}
+			return nil
+		},
+	},
+	"message": {
+		doc:  "Sends a chat message with content, attachments or both",
+		chat: true,
+		data: func() interface{} { return &SendMessageData{} },
+		check: func(msg MessagePayload) *ProtocolError {
+			if strings.TrimSpace(msg.Content) == "" && len(msg.Data.(*SendMessageData).AttachmentIDs) == 0 {
+				return protocolError(ErrCodeBadFrame, "content or data.attachment_ids is required")
+			}
+			return nil
+		},
+		handle: (*Hub).handleNewMessage,
+	},
+	"history_request": {
+		doc:  "Asks for up to 50 messages of a chat, answered with history_response",
+		chat: true,
+		data: func() interface{} { return &HistoryRequestData{} },
+		check: func(msg MessagePayload) *ProtocolError {
+			if before := msg.Data.(*HistoryRequestData).Before; before != "" {
+				if _, err := time.Parse(time.RFC3339, before); err != nil {
+					return protocolError(ErrCodeBadFrame, "data.before must be an RFC 3339 time")
+				}
+			}
+			return nil
+		},
+		handle: (*Hub).handleHistoryRequest,
+	},
+	"typing_start": {
+		doc:    "Shows the sender as typing in a chat until typing_stop or a few seconds pass",
+		chat:   true,
+		handle: (*Hub).handleTyping,
+	},
+	"typing_stop": {
+		doc:    "Clears the sender's typing indicator",
+		chat:   true,
+		handle: (*Hub).handleTyping,
+	},
+	"presence": {
+		doc:  "Switches this connection between online and away",
+		data: func() interface{} { return &PresenceRequestData{} },
+		check: func(msg MessagePayload) *ProtocolError {
+			if status := msg.Data.(*PresenceRequestData).Status; status != StatusOnline && status != StatusAway {
+				return protocolError(ErrCodeBadFrame, "data.status must be %q or %q", StatusOnline, StatusAway)
+			}
+			return nil
+		},
+		handle: (*Hub).handlePresence,
+	},
+	"mark_read": {
+		doc:    "Marks a chat read up to a message",
+		chat:   true,
+		data:   func() interface{} { return &MarkReadData{} },
+		handle: (*Hub).handleMarkRead,
+	},
+	"edit_message": {
+		doc:     "Replaces the content of one of the sender's messages",
+		chat:    true,
+		content: true,
+		data:    func() interface{} { return &MessageActionData{} },
+		check:   requireMessageID,
+		handle:  (*Hub).handleEditMessage,
+	},
+	"delete_message": {
+		doc:    "Deletes one of the sender's messages",
+		chat:   true,
+		data:   func() interface{} { return &MessageActionData{} },
+		check:  requireMessageID,
+		handle: (*Hub).handleDeleteMessage,
+	},
+	"react_message": {
+		doc:    "Sets or clears the sender's reaction on a message",
+		chat:   true,
+		data:   func() interface{} { return &MessageActionData{} },
+		check:  requireMessageID,
+		handle: (*Hub).handleReactMessage,
+	},
+}
+
+// outboundFrames lists the types the server sends with the type of their Data
+var outboundFrames = map[string]struct {
+	doc  string
+	data interface{}
+}{
+	"hello":             {"First frame on every connection", ServerHello{}},
+	"ack":               {"A client frame with an id succeeded", AckData{}},
+	"error":             {"A client frame failed; carries its id if it had one", ProtocolError{}},
+	"resync_required":   {"Resume is impossible; reload state over HTTP", SyncState{}},
+	"resume_complete":   {"Every missed event has been replayed", ResumeComplete{}},
+	"new_message":       {"A message was sent to a chat", models.Message{}},
+	"message_edited":    {"A message was edited", models.Message{}},
+	"message_deleted":   {"A message was deleted", MessageDeletedData{}},
+	"message_reaction":  {"A reaction on a message changed", MessageReactionData{}},
+	"read_receipt":      {"A participant read a chat up to a message", models.ReadReceipt{}},
+	"history_response":  {"Reply to history_request, newest first", []models.Message{}},
+	"typing_start":      {"A participant started typing", nil},
+	"typing_stop":       {"A participant stopped typing", nil},
+	"presence":          {"A contact came online, went away or went offline", PresenceData{}},
+	"notification":      {"A new notification", NotificationPayload{}},
+	"participant_added": {"Someone was added to a chat", MemberData{}},
+	"member_joined":     {"Someone joined a group chat", MemberData{}},
+	"member_left":       {"Someone left a group chat", MemberData{}},
+}
+
+func requireMessageID(msg MessagePayload) *ProtocolError {
+	if msg.Data.(*MessageActionData).MessageID == "" {
+		return protocolError(ErrCodeBadFrame, "data.message_id is required")
+	}
+	return nil
+}
+
+// decodeFrame parses and validates a frame from a client. The returned payload
+// carries the frame's typed Data. Its ID is set even when validation fails so
+// the error can be matched to the frame.
+func decodeFrame(raw []byte) (MessagePayload, *ProtocolError) {
+	var frame struct {
+		ID      string          `json:"id"`
+		Type    string          `json:"type"`
+		ChatID  string          `json:"chat_id"`
+		Content string          `json:"content"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := decodeStrict(raw, &frame); err != nil {
+		return MessagePayload{}, protocolError(ErrCodeBadFrame, "invalid frame: %v", err)
+	}
+
+	msg := MessagePayload{ID: frame.ID, Type: frame.Type, ChatID: frame.ChatID, Content: frame.Content}
+	if len(frame.ID) > maxFrameIDLength {
+		msg.ID = ""
+		return msg, protocolError(ErrCodeBadFrame, "id is longer than %d characters", maxFrameIDLength)
+	}
+
+	spec, ok := inboundFrames[frame.Type]
+	if !ok {
+		return msg, protocolError(ErrCodeUnknownType, "unknown frame type %q", frame.Type)
+	}
+	if spec.chat && frame.ChatID == "" {
+		return msg, protocolError(ErrCodeBadFrame, "chat_id is required")
+	}
+	if spec.content && strings.TrimSpace(frame.Content) == "" {
+		return msg, protocolError(ErrCodeBadFrame, "content is required")
+	}
+
+	hasData := len(frame.Data) > 0 && string(frame.Data) != "null"
+	if spec.data == nil {
+		if hasData {
+			return msg, protocolError(ErrCodeBadFrame, "%s takes no data", frame.Type)
+		}
+	} else {
+		msg.Data = spec.data()
+		if hasData {
+			if err := decodeStrict(frame.Data, msg.Data); err != nil {
+				return msg, protocolError(ErrCodeBadFrame, "invalid data: %v", err)
+			}
+		}
+	}
+
+	if spec.check != nil {
+		if err := spec.check(msg); err != nil {
+			return msg, err
+		}
+	}
+	return msg, nil
+}
+
+// decodeStrict unmarshals JSON, refusing fields the target does not declare
+func decodeStrict(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// handleFrame runs a validated client frame and answers with an ack if the
+// client gave it an id, or with an error frame. The caller must hold h.mu.
+func (h *Hub) handleFrame(msg MessagePayload) {
+	spec, ok := inboundFrames[msg.Type]
+	if !ok || spec.handle == nil {
+		return
+	}
+
+	messageID, err := spec.handle(h, msg)
+	if msg.client == nil {
+		return
+	}
+	if err != nil {
+		perr, ok := err.(*ProtocolError)
+		if !ok {
+			log.Printf("ERROR: %s from user %s failed: %v", msg.Type, msg.SenderID, err)
+			perr = errInternal
+		}
+		h.sendToClient(msg.client, errorFrame(msg.ID, perr))
+		return
+	}
+	if msg.ID != "" {
+		h.sendToClient(msg.client, MessagePayload{
+			Type: "ack",
+			ID:   msg.ID,
+			Data: AckData{MessageID: messageID},
+		})
+	}
+}
+
+func errorFrame(id string, err *ProtocolError) MessagePayload {
+	return MessagePayload{Type: "error", ID: id, Data: err}
+}
@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Limits bounds what one client may send
+type Limits struct {
+	MaxFrameBytes    int     // Larger frames close the connection
+	MaxContentLength int     // Characters in the content of a frame
+	FrameRate        float64 // Frames per second per connection
+	FrameBurst       int
+	MessageRate      float64 // "message" frames per second per user, across their connections
+	MessageBurst     int
+	MaxThrottled     int // Throttled frames per minute before the connection is closed
+}
+
+// DefaultLimits returns the limits used when none are configured
+func DefaultLimits() Limits {
+	return Limits{
+		MaxFrameBytes:    64 << 10,
+		MaxContentLength: 4000,
+		FrameRate:        20,
+		FrameBurst:       40,
+		MessageRate:      2,
+		MessageBurst:     10,
+		MaxThrottled:     50,
+	}
+}
+
+// throttleWindow is how long throttled frames are counted towards MaxThrottled
+const throttleWindow = time.Minute
+
+// tokenBucket allows burst events at once and rate per second after that
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// take spends a token if there is one, otherwise reports how long until there is
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// full reports whether the bucket has refilled, i.e. has not been used lately
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// userLimiter holds the per-user buckets shared by a user's connections
+type userLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (l *userLimiter) take(userID string, limits Limits, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	bucket, ok := l.buckets[userID]
+	if !ok {
+		bucket = newTokenBucket(limits.MessageRate, limits.MessageBurst)
+		l.buckets[userID] = bucket
+	}
+	return bucket.take(now)
+}
+
+// prune forgets buckets that have refilled; they would behave the same if recreated
+func (l *userLimiter) prune(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for userID, bucket := range l.buckets {
+		if bucket.full(now) {
+			delete(l.buckets, userID)
+		}
+	}
+}
+
+// SetLimits replaces the limits applied to clients; call it before serving connections
+func (h *Hub) SetLimits(limits Limits) {
+	h.limits = limits
+}
+
+// admit applies the rate and size limits to a decoded frame. Only readPump calls it.
+func (c *Client) admit(msg MessagePayload) *ProtocolError {
+	limits := c.Hub.limits
+	now := time.Now()
+
+	if utf8.RuneCountInString(msg.Content) > limits.MaxContentLength {
+		return protocolError(ErrCodeTooLarge, "content is longer than %d characters", limits.MaxContentLength)
+	}
+
+	ok, wait := c.frames.take(now)
+	if ok && msg.Type == "message" {
+		ok, wait = c.Hub.senders.take(c.UserID, limits, now)
+	}
+	if ok {
+		return nil
+	}
+
+	if now.Sub(c.throttledSince) > throttleWindow {
+		c.throttledSince, c.throttled = now, 0
+	}
+	c.throttled++
+	perr := protocolError(ErrCodeRateLimited, "too many frames; retry later")
+	perr.RetryAfterMs = wait.Milliseconds() + 1
+	return perr
+}
+
+// abusive reports whether the connection has been throttled too often to keep
+func (c *Client) abusive() bool {
+	return c.throttled > c.Hub.limits.MaxThrottled
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import (
+	"database/sql"
+	"log"
+
+	"social-nework/pkg/models"
+)
+
+// handleMarkRead advances the sender's read pointer and tells the rest of the chat
+func (h *Hub) handleMarkRead(msg MessagePayload) (string, error) {
+	if !h.validateChatParticipation(msg.ChatID, msg.SenderID) {
+		log.Printf("ERROR: User %s not in chat %s", msg.SenderID, msg.ChatID)
+		return "", errNotInChat
+	}
+
+	messageID := msg.Data.(*MarkReadData).MessageID
+	receipt, advanced, err := h.messageRepo.MarkChatRead(msg.ChatID, msg.SenderID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", protocolError(ErrCodeNotFound, "no such message in this chat")
+		}
+		return "", err
+	}
+	if advanced {
+		h.sendToChat(msg.ChatID, readReceiptPayload(receipt), msg.SenderID)
+	}
+	return receipt.MessageID, nil
+}
+
+// BroadcastReadReceipt tells the other members of a chat how far a participant has read
+func (h *Hub) BroadcastReadReceipt(receipt *models.ReadReceipt) {
+	h.BroadcastToChatRoom(receipt.ChatID, readReceiptPayload(receipt), receipt.UserID)
+}
+
+func readReceiptPayload(receipt *models.ReadReceipt) MessagePayload {
+	return MessagePayload{
+		Type:      "read_receipt",
+		ChatID:    receipt.ChatID,
+		SenderID:  receipt.UserID,
+		Timestamp: receipt.ReadAt,
+		Data:      receipt,
+	}
+}
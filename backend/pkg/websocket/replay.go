@@ -0,0 +1,142 @@
+package websocket
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// replayLogSize is how many recent events are kept per user for resume.
+	// It stays below the Send buffer so a full replay always fits.
+	replayLogSize = 128
+	// replayRetention is how long events are kept for a user who is not connected
+	replayRetention = 10 * time.Minute
+	// replaySweepInterval is how often Run drops expired replay logs
+	replaySweepInterval = time.Minute
+)
+
+// replayLog holds a user's sequence counter and their most recent events.
+// The counter is never reset while the hub runs so sequence numbers stay
+// monotonic even after old events are dropped.
+type replayLog struct {
+	seq     uint64
+	events  []MessagePayload
+	updated time.Time
+}
+
+func newEpoch() string {
+	return uuid.New().String()
+}
+
+// deliver stamps a payload with the user's next sequence number, keeps it in
+// their replay log and queues it for each of their connections. A connection
+// that cannot keep up is closed; the client resumes from its last sequence
+// number. The caller must hold h.mu.
+func (h *Hub) deliver(userID string, payload MessagePayload) {
+	h.logsMu.Lock()
+	defer h.logsMu.Unlock()
+
+	rl, ok := h.logs[userID]
+	if !ok {
+		rl = &replayLog{}
+		h.logs[userID] = rl
+	}
+	rl.seq++
+	payload.Seq = rl.seq
+	rl.events = append(rl.events, payload)
+	if len(rl.events) > replayLogSize {
+		rl.events = rl.events[len(rl.events)-replayLogSize:]
+	}
+	rl.updated = time.Now()
+
+	for client := range h.Clients[userID] {
+		select {
+		case client.Send <- payload:
+		default:
+			log.Printf("Client %s send buffer full for %s; closing so it can resume", userID, payload.Type)
+			client.Conn.Close()
+		}
+	}
+}
+
+// sendToClient queues a reply for one connection without a sequence number,
+// as it means nothing to the user's other connections or after a reconnect.
+// The caller must hold h.mu.
+func (h *Hub) sendToClient(client *Client, payload MessagePayload) {
+	select {
+	case client.Send <- payload:
+	default:
+		log.Printf("Client %s send buffer full for %s", client.UserID, payload.Type)
+	}
+}
+
+// resume sends a newly registered client its hello and, if it asked to resume, replays
+// the events it missed or tells it to resync. The caller must hold h.mu.
+func (h *Hub) resume(client *Client) {
+	h.logsMu.Lock()
+	defer h.logsMu.Unlock()
+
+	rl, ok := h.logs[client.UserID]
+	if !ok {
+		rl = &replayLog{updated: time.Now()}
+		h.logs[client.UserID] = rl
+	}
+
+	client.Send <- MessagePayload{
+		Type: "hello",
+		Data: ServerHello{Version: ProtocolVersion, Epoch: h.epoch, Seq: rl.seq},
+	}
+	if client.resumeSeq == nil {
+		return
+	}
+
+	missed, ok := rl.since(*client.resumeSeq)
+	if !ok || client.resumeEpoch != h.epoch {
+		log.Printf("Client %s cannot resume from %d; resync required", client.UserID, *client.resumeSeq)
+		client.Send <- MessagePayload{
+			Type: "resync_required",
+			Data: SyncState{Epoch: h.epoch, Seq: rl.seq},
+		}
+		return
+	}
+
+	for _, payload := range missed {
+		client.Send <- payload
+	}
+	client.Send <- MessagePayload{
+		Type: "resume_complete",
+		Data: ResumeComplete{Replayed: len(missed), Seq: rl.seq},
+	}
+}
+
+// since returns the events after seq, or false if some of them are no longer kept
+func (rl *replayLog) since(seq uint64) ([]MessagePayload, bool) {
+	if seq > rl.seq {
+		return nil, false
+	}
+	if seq == rl.seq {
+		return nil, true
+	}
+	if len(rl.events) == 0 || rl.events[0].Seq > seq+1 {
+		return nil, false
+	}
+	return rl.events[seq+1-rl.events[0].Seq:], true
+}
+
+// expireReplayLogs drops the kept events of users who have been gone longer
+// than replayRetention. The caller must hold h.mu.
+func (h *Hub) expireReplayLogs(now time.Time) {
+	h.logsMu.Lock()
+	defer h.logsMu.Unlock()
+
+	for userID, rl := range h.logs {
+		if _, connected := h.Clients[userID]; connected {
+			continue
+		}
+		if now.Sub(rl.updated) > replayRetention {
+			rl.events = nil
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+//go:generate go run ../../cmd/wsschema -o ../../docs/websocket-protocol.schema.json
+
+// errorCodes lists the codes of "error" frames for the schema
+var errorCodes = []string{
+	ErrCodeBadFrame,
+	ErrCodeUnknownType,
+	ErrCodeUnsupportedVersion,
+	ErrCodeForbidden,
+	ErrCodeNotFound,
+	ErrCodeInvalid,
+	ErrCodeTooLarge,
+	ErrCodeRateLimited,
+	ErrCodeInternal,
+}
+
+// ProtocolSchema describes every frame of the WebSocket protocol as a JSON
+// Schema, built from inboundFrames, outboundFrames and the Go types of their
+// data. ClientFrame and ServerFrame in $defs match any frame sent by that side.
+func ProtocolSchema() map[string]interface{} {
+	defs := map[string]interface{}{}
+
+	var clientFrames []interface{}
+	for _, name := range sortedKeys(inboundFrames) {
+		spec := inboundFrames[name]
+		props := map[string]interface{}{
+			"id":      map[string]interface{}{"type": "string", "maxLength": maxFrameIDLength, "description": "Echoed in the ack or error frame"},
+			"type":    map[string]interface{}{"const": name},
+			"chat_id": map[string]interface{}{"type": "string"},
+			"content": map[string]interface{}{"type": "string"},
+		}
+		required := []string{"type"}
+		if spec.chat {
+			required = append(required, "chat_id")
+		}
+		if spec.content {
+			required = append(required, "content")
+		}
+		if spec.data != nil {
+			props["data"] = typeSchema(reflect.TypeOf(spec.data()).Elem(), defs)
+		}
+		clientFrames = append(clientFrames, map[string]interface{}{
+			"title":                name,
+			"description":          spec.doc,
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		})
+	}
+
+	var serverFrames []interface{}
+	for _, name := range sortedKeys(outboundFrames) {
+		spec := outboundFrames[name]
+		props := map[string]interface{}{
+			"id":        map[string]interface{}{"type": "string", "description": "id of the client frame answered by an ack or error"},
+			"type":      map[string]interface{}{"const": name},
+			"chat_id":   map[string]interface{}{"type": "string"},
+			"sender_id": map[string]interface{}{"type": "string"},
+			"content":   map[string]interface{}{"type": "string"},
+			"timestamp": map[string]interface{}{"type": "integer", "description": "Unix seconds"},
+			"seq":       map[string]interface{}{"type": "integer", "description": "Per-user sequence number; send the last one seen as ?last_seq= to resume"},
+		}
+		required := []string{"type"}
+		if spec.data != nil {
+			props["data"] = typeSchema(reflect.TypeOf(spec.data), defs)
+			required = append(required, "data")
+		}
+		serverFrames = append(serverFrames, map[string]interface{}{
+			"title":       name,
+			"description": spec.doc,
+			"type":        "object",
+			"properties":  props,
+			"required":    required,
+		})
+	}
+
+	defs["ClientFrame"] = map[string]interface{}{"oneOf": clientFrames}
+	defs["ServerFrame"] = map[string]interface{}{"oneOf": serverFrames}
+	if errSchema, ok := defs["ProtocolError"].(map[string]interface{}); ok {
+		errSchema["properties"].(map[string]interface{})["code"] = map[string]interface{}{"enum": errorCodes}
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "Social network WebSocket protocol",
+		"description": "Frames exchanged over /ws. Generated from pkg/websocket; do not edit.",
+		"version":     ProtocolVersion,
+		"$defs":       defs,
+	}
+}
+
+// typeSchema returns the schema of values of t as encoding/json writes them,
+// adding named structs to defs and referring to them
+func typeSchema(t reflect.Type, defs map[string]interface{}) map[string]interface{} {
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := typeSchema(t.Elem(), defs)
+		if kind, ok := elem["type"].(string); ok {
+			elem["type"] = []string{kind, "null"}
+			return elem
+		}
+		return map[string]interface{}{"anyOf": []interface{}{elem, map[string]interface{}{"type": "null"}}}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := defs[t.Name()]; ok {
+			return ref
+		}
+		defs[t.Name()] = nil // Placeholder so recursive types terminate
+
+		props := map[string]interface{}{}
+		required := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			props[name] = typeSchema(field.Type, defs)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+		defs[t.Name()] = map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"required":             required,
+			"additionalProperties": false,
+		}
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"log"
+	"slices"
+
+	"github.com/gorilla/websocket"
+)
+
+// RevokedSessions names the login sessions whose connections must close
+type RevokedSessions struct {
+	UserID     string   `json:"user_id"`
+	SessionIDs []string `json:"session_ids,omitempty"` // Only these sessions; when empty, every session but ExceptID
+	ExceptID   string   `json:"except_id,omitempty"`
+}
+
+// covers reports whether a connection opened under sessionID must close
+func (r RevokedSessions) covers(sessionID string) bool {
+	if len(r.SessionIDs) > 0 {
+		return slices.Contains(r.SessionIDs, sessionID)
+	}
+	return sessionID != r.ExceptID
+}
+
+// CloseSessions ends the user's connections opened under the given sessions,
+// on this process and the others, once those sessions are revoked
+func (h *Hub) CloseSessions(userID string, sessionIDs ...string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	h.revokeSessions(RevokedSessions{UserID: userID, SessionIDs: sessionIDs})
+}
+
+// CloseOtherSessions ends the user's connections opened under any session but
+// exceptID, on this process and the others; an empty exceptID ends them all
+func (h *Hub) CloseOtherSessions(userID, exceptID string) {
+	h.revokeSessions(RevokedSessions{UserID: userID, ExceptID: exceptID})
+}
+
+func (h *Hub) revokeSessions(revoked RevokedSessions) {
+	h.mu.RLock()
+	h.closeSessions(revoked)
+	h.mu.RUnlock()
+
+	if err := h.broker.Publish(BrokerEvent{Sessions: &revoked}); err != nil {
+		log.Printf("ERROR: Failed to publish revoked sessions of %s to other processes: %v", revoked.UserID, err)
+	}
+}
+
+// closeSessions closes the connections here that revoked covers. Their
+// writePumps send the close frame and Run unregisters them as usual. The
+// caller must hold h.mu.
+func (h *Hub) closeSessions(revoked RevokedSessions) {
+	for client := range h.Clients[revoked.UserID] {
+		if revoked.covers(client.SessionID) {
+			log.Printf("WebSocket: Closing connection of %s, session revoked", revoked.UserID)
+			client.close(websocket.ClosePolicyViolation, "session revoked")
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package websocket
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestCloseSessionsAcrossHubs checks that revoking sessions closes the
+// connections opened under them on every hub and leaves the others open
+func TestCloseSessionsAcrossHubs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	hubA := startHub(t, path)
+	hubB := startHub(t, path)
+
+	if _, err := hubA.db.Exec(`INSERT INTO users (id, email, password_hash, first_name, last_name, nickname, avatar_url, created_at, updated_at) VALUES ('alice', 'alice@test', 'x', 'alice', 'test', 'alice', '', 1, 1)`); err != nil {
+		t.Fatalf("failed to insert fixture: %v", err)
+	}
+
+	phone := connectSession(t, hubA, "alice", "phone")
+	laptop := connectSession(t, hubA, "alice", "laptop")
+	tablet := connectSession(t, hubB, "alice", "tablet")
+
+	closed := func(client *Client) bool {
+		select {
+		case <-client.closing:
+			return true
+		case <-time.After(5 * sqliteBrokerPollInterval):
+			return false
+		}
+	}
+
+	hubB.CloseSessions("alice", "laptop")
+	if !closed(laptop) {
+		t.Errorf("the revoked laptop session is still connected")
+	}
+	for name, client := range map[string]*Client{"phone": phone, "tablet": tablet} {
+		if closed(client) {
+			t.Errorf("the %s session was closed with the laptop's", name)
+		}
+	}
+
+	hubA.CloseOtherSessions("alice", "phone")
+	if !closed(tablet) {
+		t.Errorf("the tablet session on hub B is still connected")
+	}
+	if closed(phone) {
+		t.Errorf("the phone session making the request was closed")
+	}
+
+	hubA.CloseOtherSessions("alice", "")
+	if !closed(phone) {
+		t.Errorf("the phone session is still connected after logging out everywhere")
+	}
+}
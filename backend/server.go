@@ -1,37 +1,46 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 
 	"social-nework/pkg/auth"
+	"social-nework/pkg/config"
 	"social-nework/pkg/db/sqlite"
 	"social-nework/pkg/handlers"
 	"social-nework/pkg/handlers/groups"
 	"social-nework/pkg/models"
 	"social-nework/pkg/repository"
+	"social-nework/pkg/storage"
 	"social-nework/pkg/websocket"
 )
 
-func setupChatSystem(db *sql.DB, router *mux.Router, notificationModel *models.NotificationModel) (*websocket.Hub, *repository.ChatRepository, *repository.GroupRepository) {
+func setupChatSystem(db *sql.DB, router *mux.Router, notificationModel *models.NotificationModel, store storage.Backend, urlTTL time.Duration, broker websocket.Broker, limits websocket.Limits, allowedOrigins []string) (*websocket.Hub, *repository.ChatRepository, *repository.GroupRepository) {
 	// Initialize repositories
 	chatRepo := &repository.ChatRepository{DB: db}
 	messageRepo := &repository.MessageRepository{DB: db}
 	groupRepo := &repository.GroupRepository{DB: db} // Add group repository
 
 	// Initialize WebSocket hub
-	hub := websocket.NewHub(db, messageRepo, chatRepo)
+	hub := websocket.NewHub(db, messageRepo, chatRepo, broker)
 	hub.SetNotificationModel(notificationModel) // Set the notification model
+	hub.SetLimits(limits)
+	hub.SetAllowedOrigins(allowedOrigins)
 	go hub.Run() // Start the hub in a goroutine
 	// Initialize HTTP handlers with all required repositories
-	chatHandler := handlers.NewChatHandler(chatRepo, messageRepo, groupRepo, hub, notificationModel)
+	chatHandler := handlers.NewChatHandler(chatRepo, messageRepo, groupRepo, hub, notificationModel, store, urlTTL)
 
 	// Register chat routes
 	registerChatRoutes(router, chatHandler)
@@ -55,6 +64,10 @@ func registerChatRoutes(router *mux.Router, handler *handlers.ChatHandler) {
 	router.HandleFunc("/api/chats/{chatId}/messages", auth.RequireAuth(handler.GetChatMessages)).Methods("GET")
 	router.HandleFunc("/api/chats/{chatId}/messages", auth.RequireAuth(handler.SendMessage)).Methods("POST")
 	router.HandleFunc("/api/chats/{chatId}/participants", auth.RequireAuth(handler.AddParticipant)).Methods("POST")
+	router.HandleFunc("/api/chats/{chatId}/read", auth.RequireAuth(handler.MarkChatRead)).Methods("POST")
+	router.HandleFunc("/api/chats/{chatId}/attachments", auth.RequireAuth(handler.UploadAttachment)).Methods("POST")
+	router.HandleFunc("/api/chats/{chatId}/attachments/{attachmentId}", auth.RequireAuth(handler.DownloadAttachment)).Methods("GET")
+	router.HandleFunc("/api/chats/{chatId}/messages/{messageId}/revisions", auth.RequireAuth(handler.GetMessageRevisions)).Methods("GET")
 
 	// Group chat helper route
 	router.HandleFunc("/api/groups/{groupId}/chat", auth.RequireAuth(handler.GetGroupChatForGroup)).Methods("GET")
@@ -83,24 +96,85 @@ func registerGroupRoutes(router *mux.Router, handler *groups.GroupHandler) {
 	router.HandleFunc("/api/groups/{groupId}/chat", auth.RequireAuth(handler.GetGroupChat)).Methods("GET")
 }
 
+// purgeInterval is how often soft-deleted posts past their retention are purged
+const purgeInterval = time.Hour
+
+// runPostPurge periodically hard deletes expired posts and their orphaned uploads until ctx is done
+func runPostPurge(ctx context.Context, db *sql.DB, retention time.Duration, store storage.Backend) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		purged, images, err := models.PurgeDeletedPosts(db, purgeCtx, time.Now().Add(-retention))
+		cancel()
+		if err != nil {
+			log.Printf("ERROR: Failed to purge deleted posts: %v", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d deleted posts", purged)
+		}
+
+		for _, url := range images {
+			name := filepath.Base(url)
+			if !strings.HasPrefix(url, models.UploadsPrefix) || name == "." || name == "/" {
+				continue
+			}
+			// Variants go with their original
+			files, err := models.DeleteMedia(db, ctx, name)
+			if err != nil {
+				log.Printf("ERROR: Failed to delete media %s: %v", name, err)
+				continue
+			}
+			for _, file := range files {
+				if err := store.Delete(ctx, file); err != nil {
+					log.Printf("ERROR: Failed to remove upload %s: %v", file, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// shutdownTimeout bounds how long in-flight requests and sockets get to drain
+const shutdownTimeout = 15 * time.Second
+
 func main() {
-	// Get database path from environment or use default
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "social_network.db"
-	} else {
-		// Extract just the filename if full path is provided
-		dbPath = filepath.Base(dbPath)
+	configPath := flag.String("config", os.Getenv("CONFIG_PATH"), "path to a JSON config file")
+	flag.Parse()
+
+	// Load and validate configuration before touching any resources
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
 	}
-	
-	log.Printf("DB path: %s", dbPath)
-	
+	cfg.ApplyLogging()
+
+	if err := cfg.PrepareDirs(); err != nil {
+		log.Fatalf("Failed to prepare directories: %v", err)
+	}
+
+	auth.Configure([]byte(cfg.SessionSecret), cfg.CookieSecure, cfg.SameSite())
+	auth.SetTrustedProxies(cfg.TrustedProxyNets())
+	models.SetReactions(cfg.Reactions)
+
 	// Initialize SQLite database
-	db, err := sqlite.NewDB(dbPath)
+	db, err := sqlite.NewDB(cfg.DBPath, cfg.MigrationsDir)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer db.Close()
+
+	// Server-side sessions
+	sessionModel := auth.InitSessions(db)
+	if purged, err := sessionModel.DeleteExpired(context.Background(), time.Now()); err != nil {
+		log.Printf("Failed to purge expired sessions: %v", err)
+	} else if purged > 0 {
+		log.Printf("Purged %d expired sessions", purged)
+	}
 
 	// Models
 	userModel := &auth.UserModel{DB: db}
@@ -110,8 +184,43 @@ func main() {
 	// Initialize router
 	router := mux.NewRouter()
 
+	// Uploaded files; locally stored ones are served to signed URLs under /media/
+	var store storage.Backend
+	switch cfg.Storage {
+	case "s3":
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+		if err != nil {
+			log.Fatalf("Failed to set up storage: %v", err)
+		}
+		store = s3
+	default:
+		local := storage.NewLocal(cfg.UploadDir, "/media/", cfg.URLSigningKey())
+		router.PathPrefix("/media/").Handler(local).Methods("GET", "HEAD")
+		store = local
+	}
+
+	// Hand WebSocket events to the other backend processes, if any
+	var broker websocket.Broker = websocket.NewLocalBroker()
+	if cfg.Broker == "sqlite" {
+		broker = websocket.NewSQLiteBroker(db)
+	}
+
 	// Setup chat system with all routes and get the required instances
-	hub, chatRepo, groupRepo := setupChatSystem(db, router, notificationModel)
+	hub, chatRepo, groupRepo := setupChatSystem(db, router, notificationModel, store, cfg.SignedURLTTL(), broker, websocket.Limits{
+		MaxFrameBytes:    cfg.WSMaxFrameBytes,
+		MaxContentLength: cfg.WSMaxContentLength,
+		FrameRate:        cfg.WSFrameRate,
+		FrameBurst:       cfg.WSFrameBurst,
+		MessageRate:      cfg.WSMessageRate,
+		MessageBurst:     cfg.WSMessageBurst,
+		MaxThrottled:     cfg.WSMaxThrottled,
+	}, cfg.AllowedOrigins)
 
 	// Handlers with hub for real-time notifications
 	authHandler := &handlers.AuthHandler{UserModel: userModel}
@@ -122,6 +231,7 @@ func main() {
 		DB:                db,
 	}
 	notificationHandler := handlers.NewNotificationHandler(notificationModel)
+	sessionHandler := &handlers.SessionHandler{SessionModel: sessionModel, Hub: hub}
 
 	// Now create the GroupHandler with all required dependencies
 	groupHandler := groups.NewGroupHandler(db, groupRepo, chatRepo, hub, notificationModel)
@@ -130,14 +240,27 @@ func main() {
 	router.HandleFunc("/api/register", authHandler.Register).Methods("POST")
 	router.HandleFunc("/api/login", authHandler.Login).Methods("POST")
 	router.HandleFunc("/api/logout", authHandler.Logout).Methods("POST")
+	router.HandleFunc("/api/logout/everywhere", auth.RequireAuth(sessionHandler.LogoutEverywhere)).Methods("POST")
 	router.HandleFunc("/api/profile", auth.RequireAuth(handlers.GetProfile(db))).Methods("GET")
 	router.HandleFunc("/api/profile", auth.RequireAuth(handlers.UpdateProfile(db))).Methods("PUT")
 
+	// Session routes
+	router.HandleFunc("/api/csrf", auth.RequireAuth(sessionHandler.CSRFToken)).Methods("GET")
+	router.HandleFunc("/api/sessions", auth.RequireAuth(sessionHandler.ListSessions)).Methods("GET")
+	router.HandleFunc("/api/sessions", auth.RequireAuth(sessionHandler.RevokeOtherSessions)).Methods("DELETE")
+	router.HandleFunc("/api/sessions/{id}", auth.RequireAuth(sessionHandler.RevokeSession)).Methods("DELETE")
+
 	// Follow routes
 	router.HandleFunc("/api/users/{userID}/follow", auth.RequireAuth(followHandler.Follow)).Methods("POST")
 	router.HandleFunc("/api/users/{userID}/unfollow", auth.RequireAuth(followHandler.Unfollow)).Methods("DELETE")
 	router.HandleFunc("/api/follow/check", auth.RequireAuth(followHandler.CheckFollowStatus)).Methods("GET")
 
+	// Block routes; a mute only hides the muted user's posts from the feed
+	router.HandleFunc("/api/users/{userID}/block", auth.RequireAuth(handlers.AddBlock(db, models.BlockKindBlock))).Methods("POST")
+	router.HandleFunc("/api/users/{userID}/block", auth.RequireAuth(handlers.RemoveBlock(db, models.BlockKindBlock))).Methods("DELETE")
+	router.HandleFunc("/api/users/{userID}/mute", auth.RequireAuth(handlers.AddBlock(db, models.BlockKindMute))).Methods("POST")
+	router.HandleFunc("/api/users/{userID}/mute", auth.RequireAuth(handlers.RemoveBlock(db, models.BlockKindMute))).Methods("DELETE")
+
 	// Follow request routes
 	router.HandleFunc("/api/follow-requests/{followerID}/accept", auth.RequireAuth(followHandler.AcceptFollowRequest)).Methods("POST")
 	router.HandleFunc("/api/follow-requests/{followerID}/decline", auth.RequireAuth(followHandler.DeclineFollowRequest)).Methods("POST")
@@ -150,13 +273,21 @@ func main() {
 	registerGroupRoutes(router, groupHandler)
 
 	// Posts routes
+	router.HandleFunc("/api/feed", auth.RequireAuth(handlers.Feed(db))).Methods("GET")
 	router.HandleFunc("/api/posts", auth.RequireAuth(handlers.AllPosts(db))).Methods("GET")
 	router.HandleFunc("/api/posts", auth.RequireAuth(handlers.NewPost(db))).Methods("POST")
 	router.HandleFunc("/api/posts/{post_id}", auth.RequireAuth(handlers.GetSinglePost(db))).Methods("GET")
+	router.HandleFunc("/api/posts/{post_id}", auth.RequireAuth(handlers.UpdatePost(db))).Methods("PUT")
 	router.HandleFunc("/api/posts/{post_id}", auth.RequireAuth(handlers.DeletPost(db))).Methods("DELETE")
+	router.HandleFunc("/api/posts/{post_id}/restore", auth.RequireAuth(handlers.RestorePost(db, cfg.PostRetention()))).Methods("POST")
+	router.HandleFunc("/api/posts/{post_id}/revisions", auth.RequireAuth(handlers.GetPostRevisions(db))).Methods("GET")
+
+	// Upload routes; files are only handed out, as signed URLs, to users who can see the post, comment or profile using them
+	router.HandleFunc("/api/upload", auth.RequireAuth(handlers.UploadImage(db, store))).Methods("POST")
+	router.HandleFunc("/uploads/{filename}", auth.RequireAuth(handlers.ServeUpload(db, store, cfg.SignedURLTTL()))).Methods("GET")
 
-	// Comment routes - temporarily remove auth from GET to debug
-	router.HandleFunc("/comments/{postId}", handlers.GetPostComments(db)).Methods("GET")
+	// Comment routes
+	router.HandleFunc("/comments/{postId}", auth.RequireAuth(handlers.GetPostComments(db))).Methods("GET")
 	router.HandleFunc("/comment/{postId}", auth.RequireAuth(handlers.CreateComment(db, notificationModel, hub))).Methods("POST")
 
 	// Add debugging middleware for comment routes
@@ -173,21 +304,93 @@ func main() {
 	router.HandleFunc("/api/posts/{post_id}/like", auth.RequireAuth(handlers.LikePost(db, notificationModel, hub))).Methods("POST")
 	router.HandleFunc("/api/posts/{post_id}/like", auth.RequireAuth(handlers.LikePost(db, notificationModel, hub))).Methods("DELETE")
 	router.HandleFunc("/api/posts/{post_id}/likes", auth.RequireAuth(handlers.GetPostLikes(db))).Methods("GET")
+	router.HandleFunc("/api/comments/{comment_id}", auth.RequireAuth(handlers.UpdateComment(db))).Methods("PUT")
+	router.HandleFunc("/api/comments/{comment_id}", auth.RequireAuth(handlers.DeleteComment(db))).Methods("DELETE")
 	router.HandleFunc("/api/comments/{comment_id}/like", auth.RequireAuth(handlers.LikeComment(db, notificationModel, hub))).Methods("POST")
 	router.HandleFunc("/api/comments/{comment_id}/like", auth.RequireAuth(handlers.LikeComment(db, notificationModel, hub))).Methods("DELETE")
 	router.HandleFunc("/api/comments/{comment_id}/likes", auth.RequireAuth(handlers.GetCommentLikes(db))).Methods("GET")
 
+	// Reaction routes
+	router.HandleFunc("/api/posts/{post_id}/reactions", auth.RequireAuth(handlers.React(db, notificationModel, hub, "post"))).Methods("PUT")
+	router.HandleFunc("/api/posts/{post_id}/reactions", auth.RequireAuth(handlers.RemoveReaction(db, "post"))).Methods("DELETE")
+	router.HandleFunc("/api/posts/{post_id}/reactions", auth.RequireAuth(handlers.GetReactions(db, "post"))).Methods("GET")
+	router.HandleFunc("/api/comments/{comment_id}/reactions", auth.RequireAuth(handlers.React(db, notificationModel, hub, "comment"))).Methods("PUT")
+	router.HandleFunc("/api/comments/{comment_id}/reactions", auth.RequireAuth(handlers.RemoveReaction(db, "comment"))).Methods("DELETE")
+	router.HandleFunc("/api/comments/{comment_id}/reactions", auth.RequireAuth(handlers.GetReactions(db, "comment"))).Methods("GET")
+
+	// State-changing requests made with a session cookie must carry its CSRF token
+	router.Use(auth.CSRFProtect)
+
 	// Enable CORS
 	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:3000", "http://localhost:8080"},
+		AllowedOrigins:   cfg.AllowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
+		ExposedHeaders:   []string{auth.CSRFHeader},
 		AllowCredentials: true,
-		Debug:            true, // Add debug logging
+		Debug:            cfg.LogLevel == "debug",
 	})
 
 	handler := c.Handler(router)
 
-	log.Println("Server starting on :3000")
-	log.Fatal(http.ListenAndServe(":3000", handler))
+	srv := &http.Server{
+		Addr:    cfg.ListenAddr,
+		Handler: handler,
+	}
+
+	// Stop on SIGINT/SIGTERM so deploys drain instead of dropping connections
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Background purge of soft-deleted posts; stops with ctx
+	purgeDone := make(chan struct{})
+	go func() {
+		defer close(purgeDone)
+		runPostPurge(ctx, db, cfg.PostRetention(), store)
+	}()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting on %s", cfg.ListenAddr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
+		close(serverErr)
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			stop()
+			<-purgeDone
+			db.Close()
+			log.Fatalf("Server failed: %v", err)
+		}
+	case <-ctx.Done():
+		log.Println("Shutdown signal received")
+	}
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Stop accepting connections and drain in-flight HTTP requests
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server shutdown: %v", err)
+	}
+
+	// Send going-away frames to WebSocket clients and stop the hub
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Printf("WebSocket hub shutdown: %v", err)
+	}
+	if err := broker.Close(); err != nil {
+		log.Printf("WebSocket broker close: %v", err)
+	}
+
+	<-purgeDone
+	if err := db.Close(); err != nil {
+		log.Printf("Database close: %v", err)
+	}
+
+	log.Println("Server stopped")
 }
@@ -1,24 +1,17 @@
 
 import { CreatePost } from "@/components/create-post";
-import { PostCard } from "@/components/post-card";
+import { FeedList } from "@/components/feed-list";
 import { SuggestedGroups } from "@/components/suggested-groups";
 import { ScrollArea } from "@/components/ui/scroll-area";
-import { Card, CardContent } from "@/components/ui/card";
 import { cookies } from 'next/headers';
 import { API_BASE_URL } from "@/lib/config";
+import type { Post } from "@/types";
 
-// This interface matches the backend response for a single post
-interface Post {
-  id: string;
-  user_id: string;
-  group_id: string | null;
-  content: string;
-  privacy: 'public' | 'almost_private' | 'private';
-  created_at: number;
-  updated_at: number;
-  deleted_at: number | null;
-  likes_count: number;
-  user_liked: boolean;
+// One page of /api/feed; further pages are loaded by FeedList
+interface FeedPage {
+  posts: Post[];
+  next_cursor: string | null;
+  has_more: boolean;
 }
 
 interface Group {
@@ -31,10 +24,11 @@ interface Group {
     updated_at: number;
 }
 
-async function getPosts(sessionCookie: { name: string; value: string } | undefined) {
-  if (!sessionCookie) return [];
+async function getFeed(sessionCookie: { name: string; value: string } | undefined): Promise<FeedPage> {
+  const empty: FeedPage = { posts: [], next_cursor: null, has_more: false };
+  if (!sessionCookie) return empty;
   try {
-    const res = await fetch(`${API_BASE_URL}/api/posts`, { 
+    const res = await fetch(`${API_BASE_URL}/api/feed`, { 
       headers: {
         'Cookie': `${sessionCookie.name}=${sessionCookie.value}`,
       },
@@ -42,15 +36,19 @@ async function getPosts(sessionCookie: { name: string; value: string } | undefin
     });
 
     if (!res.ok) {
-      console.error('Failed to fetch posts:', res.status, res.statusText);
-      return [];
+      console.error('Failed to fetch feed:', res.status, res.statusText);
+      return empty;
     }
 
     const data = await res.json();
-    return Array.isArray(data) ? data : [];
+    return {
+      posts: Array.isArray(data.posts) ? data.posts : [],
+      next_cursor: data.has_more ? data.next_cursor : null,
+      has_more: Boolean(data.has_more),
+    };
   } catch (error) {
-    console.error('Error fetching posts:', error);
-    return [];
+    console.error('Error fetching feed:', error);
+    return empty;
   }
 }
 
@@ -80,8 +78,8 @@ export default async function HomePage() {
   const cookieStore = await cookies();
   const sessionCookie = cookieStore.get('social-network-session');
 
-  const [posts, groups] = await Promise.all([
-    getPosts(sessionCookie),
+  const [feed, groups] = await Promise.all([
+    getFeed(sessionCookie),
     getGroups(sessionCookie)
   ]);
 
@@ -92,18 +90,7 @@ export default async function HomePage() {
               <ScrollArea className="h-[calc(100vh-100px)]">
                 <div className="pr-4 space-y-6">
                   <CreatePost />
-                  {posts.length > 0 ? (
-                    posts.map((post) => (
-                      <PostCard key={post.id} {...post} />
-                    ))
-                  ) : (
-                    <Card>
-                      <CardContent className="p-8 text-center text-muted-foreground">
-                        <p>No posts found.</p>
-                        <p className="text-sm">Be the first to post, or make sure you are logged in.</p>
-                      </CardContent>
-                    </Card>
-                  )}
+                  <FeedList initialPosts={feed.posts} initialCursor={feed.next_cursor} />
                 </div>
               </ScrollArea>
             </div>
@@ -19,6 +19,7 @@ interface Comment {
     user_avatar: string;
     likes_count: number;
     user_liked: boolean;
+    deleted?: boolean;
 }
 
 interface CommentSectionProps {
@@ -144,7 +145,7 @@ export function CommentSection({ postId }: CommentSectionProps) {
                             <div className="flex-1">
                                 <div className="bg-secondary rounded-lg px-3 py-2">
                                     <p className="font-semibold">{comment.user_nickname || comment.user_id}</p>
-                                    <p>{comment.content}</p>
+                                    <p>{comment.deleted ? <span className="italic text-muted-foreground">[deleted]</span> : comment.content}</p>
                                 </div>
                                 <div className="text-xs text-muted-foreground px-3 pt-1">
                                     {new Date(comment.created_at * 1000).toLocaleString()}
@@ -0,0 +1,73 @@
+'use client';
+import { useState } from "react";
+import { PostCard } from "./post-card";
+import { Button } from "./ui/button";
+import { Card, CardContent } from "./ui/card";
+import { useToast } from "@/hooks/use-toast";
+import { API_BASE_URL } from "@/lib/config";
+import type { Post } from "@/types";
+
+interface FeedListProps {
+  initialPosts: Post[];
+  initialCursor: string | null;
+}
+
+// FeedList shows the first page of /api/feed rendered by the server and loads
+// the following pages with the cursor returned alongside each one
+export function FeedList({ initialPosts, initialCursor }: FeedListProps) {
+  const [posts, setPosts] = useState<Post[]>(initialPosts);
+  const [cursor, setCursor] = useState<string | null>(initialCursor);
+  const [loading, setLoading] = useState(false);
+  const { toast } = useToast();
+
+  const loadMore = async () => {
+    if (!cursor || loading) return;
+    setLoading(true);
+    try {
+      const res = await fetch(`${API_BASE_URL}/api/feed?cursor=${encodeURIComponent(cursor)}`, {
+        credentials: 'include',
+      });
+      if (!res.ok) throw new Error(`Failed to load posts: ${res.status}`);
+
+      const data = await res.json();
+      const page: Post[] = Array.isArray(data.posts) ? data.posts : [];
+      // Skip posts already shown, e.g. after a post was created meanwhile
+      setPosts((current) => {
+        const seen = new Set(current.map((post) => post.id));
+        return [...current, ...page.filter((post) => !seen.has(post.id))];
+      });
+      setCursor(data.has_more ? data.next_cursor : null);
+    } catch (error) {
+      console.error('Error loading more posts:', error);
+      toast({ title: "Error", description: "Could not load more posts.", variant: "destructive" });
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  if (posts.length === 0) {
+    return (
+      <Card>
+        <CardContent className="p-8 text-center text-muted-foreground">
+          <p>No posts found.</p>
+          <p className="text-sm">Be the first to post, or make sure you are logged in.</p>
+        </CardContent>
+      </Card>
+    );
+  }
+
+  return (
+    <>
+      {posts.map((post) => (
+        <PostCard key={post.id} {...post} />
+      ))}
+      {cursor && (
+        <div className="flex justify-center">
+          <Button variant="outline" onClick={loadMore} disabled={loading}>
+            {loading ? 'Loading...' : 'Load more'}
+          </Button>
+        </div>
+      )}
+    </>
+  );
+}
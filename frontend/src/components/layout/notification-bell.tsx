@@ -38,6 +38,7 @@ const icons: { [key: string]: React.ElementType } = {
   new_message: MessageSquare,
   new_like: Heart,
   new_comment: MessageSquare,
+  comment_reply: MessageSquare,
   group_join_response: Users,
   group_invitation_response: Users
 }
@@ -228,10 +229,16 @@ export function NotificationBell() {
         return 'started following you'
       case 'follow_request':
         return 'sent you a follow request'
-      case 'new_like':
-        return 'liked your post'
+      case 'new_like': {
+        const target = data?.likeable_type === 'comment' ? 'your comment' : 'your post'
+        return data?.reaction && data.reaction !== 'like'
+          ? `reacted with ${data.reaction} to ${target}`
+          : `liked ${target}`
+      }
       case 'new_comment':
         return 'commented on your post'
+      case 'comment_reply':
+        return 'replied to your comment'
       case 'new_message':
         return 'sent you a message'
       case 'group_invite':
@@ -256,6 +263,7 @@ export function NotificationBell() {
         return `/profile/${referenceId}`
       case 'new_like':
       case 'new_comment':
+      case 'comment_reply':
         return `/post/${referenceId}`
       case 'new_message':
         return `/chat/${referenceId}`
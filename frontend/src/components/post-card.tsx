@@ -14,7 +14,7 @@ import { useToast } from "@/hooks/use-toast";
 import { cn } from "@/lib/utils";
 import { API_BASE_URL } from "@/lib/config";
 import { CommentSection } from "./comment-section";
-import type { User } from "@/types";
+import type { PostMedia, User } from "@/types";
 import { useUser } from "@/contexts/user-context";
 import { Skeleton } from "./ui/skeleton";
 
@@ -28,9 +28,10 @@ interface PostCardProps {
   user_liked: boolean;
   imageUrl?: string;
   imageHint?: string;
+  media?: PostMedia[];
 }
 
-export function PostCard({ id, user_id, content, privacy, created_at, likes_count, user_liked, imageUrl, imageHint }: PostCardProps) {
+export function PostCard({ id, user_id, content, privacy, created_at, likes_count, user_liked, imageUrl, imageHint, media }: PostCardProps) {
     const [isLiked, setIsLiked] = useState(user_liked);
     const [likeCount, setLikeCount] = useState(likes_count);
     const [showComments, setShowComments] = useState(false);
@@ -186,6 +187,20 @@ export function PostCard({ id, user_id, content, privacy, created_at, likes_coun
                 <Image src={imageUrl} alt="Post image" fill={true} style={{objectFit: 'cover'}} data-ai-hint={imageHint} />
             </div>
         )}
+        {media && media.length > 0 && (
+            <div className={cn("grid gap-1 overflow-hidden rounded-lg border", media.length > 1 && "grid-cols-2")}>
+                {media.map(item => (
+                    <div key={item.id} className="relative aspect-square w-full bg-muted">
+                        {item.kind === 'video' ? (
+                            <video src={`${API_BASE_URL}${item.url}`} controls preload="metadata" aria-label={item.alt_text || undefined} className="h-full w-full object-cover" />
+                        ) : (
+                            // eslint-disable-next-line @next/next/no-img-element
+                            <img src={`${API_BASE_URL}${media.length > 1 ? item.thumbnail_url : item.medium_url}`} alt={item.alt_text} loading="lazy" className="h-full w-full object-cover" />
+                        )}
+                    </div>
+                ))}
+            </div>
+        )}
       </CardContent>
       <CardFooter className="flex justify-between p-4 pt-2 border-b">
         <div className="flex gap-4">
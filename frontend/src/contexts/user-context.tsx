@@ -3,6 +3,9 @@
 import React, { createContext, useContext, useState, useEffect, ReactNode, useCallback, useMemo } from 'react';
 import { API_BASE_URL } from '@/lib/config';
 import { useDebounce } from '@/hooks/use-debounce';
+import { installCsrfFetch } from '@/lib/csrf';
+
+installCsrfFetch();
 
 // This interface matches the 'data' object in the successful login response
 // and the shape of the user object in the profile response.
@@ -22,6 +22,9 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
   const reconnectTimeoutRef = useRef<NodeJS.Timeout>()
   const reconnectAttemptsRef = useRef(0)
   const maxReconnectAttempts = 5
+  // Last event sequence number and server epoch seen, sent back on reconnect to replay missed events
+  const lastSeqRef = useRef<number | null>(null)
+  const epochRef = useRef<string | null>(null)
 
   const connectWebSocket = useCallback(() => {
     if (!user?.id) {
@@ -36,7 +39,11 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
 
     console.log('Setting up global WebSocket connection for user:', user.id)
     
-    const websocket = new WebSocket(`ws://localhost:3000/ws?user_id=${user.id}`)
+    let url = `ws://localhost:3000/ws?user_id=${user.id}`
+    if (lastSeqRef.current !== null && epochRef.current) {
+      url += `&last_seq=${lastSeqRef.current}&epoch=${epochRef.current}`
+    }
+    const websocket = new WebSocket(url)
     
     websocket.onopen = () => {
       console.log('Global WebSocket connected for user:', user.id)
@@ -73,6 +80,21 @@ export function WebSocketProvider({ children }: { children: ReactNode }) {
     
     websocket.onmessage = (event) => {
       console.log('Global WebSocket message received:', event.data)
+      try {
+        const data = JSON.parse(event.data)
+        if (data.type === 'hello' && data.data?.epoch !== epochRef.current) {
+          // New server epoch: nothing to resume from
+          epochRef.current = data.data.epoch
+          lastSeqRef.current = data.data.seq
+        } else if (data.type === 'resync_required') {
+          epochRef.current = data.data?.epoch ?? null
+          lastSeqRef.current = data.data?.seq ?? null
+        } else if (typeof data.seq === 'number') {
+          lastSeqRef.current = data.seq
+        }
+      } catch {
+        // Not JSON; nothing to track
+      }
     }
     
     return websocket
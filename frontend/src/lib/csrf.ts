@@ -0,0 +1,53 @@
+// The backend rejects POST, PUT and DELETE requests made with the session cookie
+// unless they carry the session's CSRF token in the X-CSRF-Token header.
+// installCsrfFetch wraps window.fetch so every call to the API sends it.
+
+import { API_BASE_URL } from './config';
+
+const CSRF_HEADER = 'X-CSRF-Token';
+const SAFE_METHODS = ['GET', 'HEAD', 'OPTIONS'];
+
+let token: string | null = null;
+let installed = false;
+
+// The backend sends the token on login and from /api/csrf
+function remember(response: Response): Response {
+  const issued = response.headers.get(CSRF_HEADER);
+  if (issued) token = issued;
+  return response;
+}
+
+export function installCsrfFetch() {
+  if (installed || typeof window === 'undefined') return;
+  installed = true;
+
+  const originalFetch = window.fetch.bind(window);
+
+  const refreshToken = async () => {
+    token = null;
+    const response = await originalFetch(`${API_BASE_URL}/api/csrf`, { credentials: 'include' });
+    if (response.ok) remember(response);
+  };
+
+  window.fetch = async (input: RequestInfo | URL, init?: RequestInit) => {
+    const url = typeof input === 'string' ? input : input instanceof URL ? input.href : input.url;
+    const method = (init?.method ?? (input instanceof Request ? input.method : 'GET')).toUpperCase();
+    if (!url.startsWith(API_BASE_URL) || SAFE_METHODS.includes(method)) {
+      return remember(await originalFetch(input, init));
+    }
+
+    const send = () => {
+      const headers = new Headers(init?.headers ?? (input instanceof Request ? input.headers : undefined));
+      if (token) headers.set(CSRF_HEADER, token);
+      return originalFetch(input, { ...init, headers });
+    };
+
+    let response = await send();
+    // The token is lost on reload; fetch it once and retry
+    if (response.status === 403 && (await response.clone().text()).includes('CSRF')) {
+      await refreshToken();
+      if (token) response = await send();
+    }
+    return remember(response);
+  };
+}
@@ -23,6 +23,21 @@ export interface Post {
     deleted_at: number | null;
     likes_count: number;
     user_liked: boolean;
+    media?: PostMedia[];
+}
+
+// One item of a post's gallery; URLs are paths on the API server
+export interface PostMedia {
+    id: string;
+    kind: 'image' | 'video';
+    mime_type: string;
+    width?: number;
+    height?: number;
+    url: string;
+    medium_url: string;
+    thumbnail_url: string;
+    position: number;
+    alt_text: string;
 }
 
 export interface Group {